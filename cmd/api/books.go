@@ -83,6 +83,12 @@ func (a *appDependencies) displayBookHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	book.Ratings, err = a.reviewModel.Summarize(book.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
 	data := envelope{
 		"book": book,
 	}
@@ -200,14 +206,20 @@ func (a *appDependencies) deleteBookHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-/* List all books */
+/* List all books, optionally searching by title, author and genre */
 func (a *appDependencies) listBooksHandler(w http.ResponseWriter, r *http.Request) {
 	var queryParametersData struct {
+		Title  string
+		Author string
+		Genre  string
 		data.Filters
 	}
 	queryParameters := r.URL.Query()
+	queryParametersData.Title = a.getSingleQueryParameters(queryParameters, "title", "")
+	queryParametersData.Author = a.getSingleQueryParameters(queryParameters, "author", "")
+	queryParametersData.Genre = a.getSingleQueryParameters(queryParameters, "genre", "")
 	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "-id"}
+	queryParametersData.Filters.SortSafeList = data.BookSortSafeList
 	v := validator.New()
 	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
@@ -217,7 +229,7 @@ func (a *appDependencies) listBooksHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	book, metadata, err := a.bookModel.GetAll(queryParametersData.Filters)
+	book, metadata, err := a.bookModel.GetAll(queryParametersData.Title, queryParametersData.Author, queryParametersData.Genre, queryParametersData.Filters)
 	if err != nil {
 		a.serverErr(w, r, err)
 		return
@@ -234,38 +246,89 @@ func (a *appDependencies) listBooksHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-/* Search for a book based on filters */
-func (a *appDependencies) searchBooksHandler(w http.ResponseWriter, r *http.Request) {
-	var queryParametersData struct {
-		Title  string
-		Author string
-		Genre  string
-		data.Filters
+/* Mark a book as finished by the current user */
+func (a *appDependencies) finishBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
 	}
-	queryParameters := r.URL.Query()
-	queryParametersData.Title = a.getSingleQueryParameters(queryParameters, "title", "")
-	queryParametersData.Author = a.getSingleQueryParameters(queryParameters, "author", "")
-	queryParametersData.Genre = a.getSingleQueryParameters(queryParameters, "genre", "")
-	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "title", "author", "genre", "-id", "-title", "-author", "-genre"}
+
+	var incomingData struct {
+		FinishedAt *time.Time `json:"finished_at"`
+	}
+	if r.ContentLength != 0 {
+		err = a.readJSON(w, r, &incomingData)
+		if err != nil {
+			a.badRequest(w, r, err)
+			return
+		}
+	}
+
+	book, err := a.bookModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	finished := &data.FinishedBook{
+		UserID:     a.ctxGetUser(r).ID,
+		BookID:     book.ID,
+		FinishedAt: time.Now(),
+	}
+	if incomingData.FinishedAt != nil {
+		finished.FinishedAt = *incomingData.FinishedAt
+	}
+
 	v := validator.New()
-	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
-	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
-	data.ValidateFilters(v, queryParametersData.Filters)
+	data.ValidateFinishedBook(v, finished)
 	if !v.IsEmpty() {
 		a.failedValidation(w, r, v.Errors)
 		return
 	}
 
-	book, metadata, err := a.bookModel.Search(queryParametersData.Title, queryParametersData.Author, queryParametersData.Genre, queryParametersData.Filters)
+	err = a.finishedBookModel.Insert(finished)
 	if err != nil {
 		a.serverErr(w, r, err)
 		return
 	}
 
 	data := envelope{
-		"book":      book,
-		"@metadata": metadata,
+		"finished": finished,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Remove the current user's finished mark from a book */
+func (a *appDependencies) unfinishBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	err = a.finishedBookModel.Delete(a.ctxGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "book successfully unmarked as finished",
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
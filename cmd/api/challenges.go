@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Create a new shared reading challenge, the creator joins it automatically */
+func (a *appDependencies) createChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Name     string    `json:"name"`
+		Desc     string    `json:"description"`
+		Genre    string    `json:"genre"`
+		Target   int       `json:"target"`
+		StartsAt time.Time `json:"starts_at"`
+		EndsAt   time.Time `json:"ends_at"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	challenge := &data.Challenge{
+		Name:      incomingData.Name,
+		Desc:      incomingData.Desc,
+		Genre:     incomingData.Genre,
+		Target:    incomingData.Target,
+		StartsAt:  incomingData.StartsAt,
+		EndsAt:    incomingData.EndsAt,
+		CreatedBy: user.ID,
+	}
+
+	v := validator.New()
+	data.ValidateChallenge(v, challenge)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.challengeModel.Insert(challenge)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	err = a.challengeModel.Join(challenge.ID, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	challenge.Participants = 1
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/challenges/%d", challenge.ID))
+	data := envelope{
+		"challenge": challenge,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* List all challenges */
+func (a *appDependencies) listChallengesHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "-starts_at")
+	queryParametersData.Filters.SortSafeList = []string{"id", "name", "starts_at", "ends_at", "-id", "-name", "-starts_at", "-ends_at"}
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	challenges, metadata, err := a.challengeModel.GetAll(queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"challenges": challenges,
+		"@metadata":  metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display a challenge */
+func (a *appDependencies) displayChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	challenge, err := a.challengeModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"challenge": challenge,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display the ranked participants of a challenge */
+func (a *appDependencies) challengeLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	v := validator.New()
+	queryParametersData.Filters.Sort = "rank"
+	queryParametersData.Filters.SortSafeList = []string{"rank"}
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 25, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	challenge, err := a.challengeModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	standings, metadata, err := a.challengeModel.Leaderboard(challenge, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"challenge":   challenge,
+		"leaderboard": standings,
+		"@metadata":   metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Add the current user to a challenge */
+func (a *appDependencies) joinChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	challenge, err := a.challengeModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if challenge.HasEnded(time.Now()) {
+		v := validator.New()
+		v.AddError("challenge", "this challenge has already ended")
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.challengeModel.Join(challenge.ID, a.ctxGetUser(r).ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "successfully joined challenge",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Remove the current user from a challenge */
+func (a *appDependencies) leaveChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	err = a.challengeModel.Leave(id, a.ctxGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "successfully left challenge",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
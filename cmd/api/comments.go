@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Comment on a review, or reply to one of its comments */
+func (a *appDependencies) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var incomingData struct {
+		ParentID *int64 `json:"parent_id"`
+		Body     string `json:"body"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	review, err := a.reviewModel.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if review.Hidden && !a.canSeeHidden(r, review.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	comment := &data.Comment{
+		ReviewID: review.ID,
+		UserID:   user.ID,
+		ParentID: incomingData.ParentID,
+		Body:     incomingData.Body,
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, a.screener, comment)
+	if comment.ParentID != nil {
+		parent, err := a.commentModel.Get(*comment.ParentID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be an existing comment")
+		case err != nil:
+			a.serverErr(w, r, err)
+			return
+		default:
+			v.Check(parent.ReviewID == review.ID, "parent_id", "must be a comment on the same review")
+		}
+	}
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Insert(comment)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.recordPost(comment.UserID)
+	a.flagForModeration(v, "comment", comment.ID)
+
+	// let the reviewer know someone has responded, unless they are talking to themselves
+	if review.UserID != user.ID {
+		a.background(func() {
+			reviewer, err := a.userModel.Get(review.UserID)
+			if err != nil {
+				a.logger.Error(err.Error())
+				return
+			}
+
+			data := map[string]any{
+				"username":  user.Username,
+				"bookID":    review.BookID,
+				"reviewID":  review.ID,
+				"commentID": comment.ID,
+				"body":      comment.Body,
+			}
+			err = a.mailer.Send(reviewer.Email, "review_comment.tmpl", data)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		})
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/comments/%d", comment.ID))
+	data := envelope{
+		"comment": comment,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* List a review's comments as threads, paging through the top level comments */
+func (a *appDependencies) listReviewCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "created_at")
+	queryParametersData.Filters.SortSafeList = []string{"created_at", "-created_at"}
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	review, err := a.reviewModel.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if review.Hidden && !a.canSeeHidden(r, review.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	comments, metadata, err := a.commentModel.GetAllForReview(reviewID, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comments":  comments,
+		"@metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display a comment */
+func (a *appDependencies) displayCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if comment.Hidden && !a.canSeeHidden(r, comment.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	data := envelope{
+		"comment": comment,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Edit one of the current user's comments */
+func (a *appDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if comment.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Body *string `json:"body"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	if incomingData.Body != nil {
+		comment.Body = *incomingData.Body
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, a.screener, comment)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflict(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	a.flagForModeration(v, "comment", comment.ID)
+
+	data := envelope{
+		"comment": comment,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Delete one of the current user's comments, replies to it go with it */
+func (a *appDependencies) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if comment.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	err = a.commentModel.Delete(comment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "comment successfully deleted",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 type ctxKey string
 
 const userCtxKey = ctxKey("user")
+const tokenCtxKey = ctxKey("token")
 
 func (a *appDependencies) ctxSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userCtxKey, user)
@@ -24,3 +25,18 @@ func (a *appDependencies) ctxGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+/* Keep the plaintext of the token a request authenticated with, so the session it belongs to can be found */
+func (a *appDependencies) ctxSetToken(r *http.Request, plaintext string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenCtxKey, plaintext)
+	return r.WithContext(ctx)
+}
+
+func (a *appDependencies) ctxGetToken(r *http.Request) string {
+	plaintext, ok := r.Context().Value(tokenCtxKey).(string)
+	if !ok {
+		panic("missing token value in request context")
+	}
+
+	return plaintext
+}
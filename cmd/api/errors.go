@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (a *appDependencies) logErr(r *http.Request, err error) {
@@ -51,6 +54,13 @@ func (a *appDependencies) rateLimitExceed(w http.ResponseWriter, r *http.Request
 	a.errResponseJSON(w, r, http.StatusTooManyRequests, msg)
 }
 
+func (a *appDependencies) loginThrottled(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	msg := fmt.Sprintf("too many failed login attempts, try again in %d seconds", seconds)
+	a.errResponseJSON(w, r, http.StatusTooManyRequests, msg)
+}
+
 func (a *appDependencies) editConflict(w http.ResponseWriter, r *http.Request) {
 	msg := "unable to update record to due an edit conflict, try again"
 	a.errResponseJSON(w, r, http.StatusConflict, msg)
@@ -62,6 +72,11 @@ func (a *appDependencies) invalidAuthToken(w http.ResponseWriter, r *http.Reques
 	a.errResponseJSON(w, r, http.StatusUnauthorized, msg)
 }
 
+func (a *appDependencies) invalidRefreshToken(w http.ResponseWriter, r *http.Request) {
+	msg := "invalid/expired refresh token, log in again"
+	a.errResponseJSON(w, r, http.StatusUnauthorized, msg)
+}
+
 func (a *appDependencies) authRequired(w http.ResponseWriter, r *http.Request) {
 	msg := "you must be authenticated to access this resource"
 	a.errResponseJSON(w, r, http.StatusUnauthorized, msg)
@@ -72,7 +87,17 @@ func (a *appDependencies) inactiveAccount(w http.ResponseWriter, r *http.Request
 	a.errResponseJSON(w, r, http.StatusForbidden, msg)
 }
 
+func (a *appDependencies) mfaSetupRequired(w http.ResponseWriter, r *http.Request) {
+	msg := "your user account must have two-factor authentication turned on to access this resource"
+	a.errResponseJSON(w, r, http.StatusForbidden, msg)
+}
+
 func (a *appDependencies) invalidCredentials(w http.ResponseWriter, r *http.Request) {
 	msg := "invalid auth credentials"
 	a.errResponseJSON(w, r, http.StatusUnauthorized, msg)
 }
+
+func (a *appDependencies) notPermitted(w http.ResponseWriter, r *http.Request) {
+	msg := "your user account doesn't have the necessary permissions to access this resource"
+	a.errResponseJSON(w, r, http.StatusForbidden, msg)
+}
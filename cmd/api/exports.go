@@ -0,0 +1,248 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Start putting together a ZIP of everything we hold about the current user, a download link is emailed when it is ready */
+func (a *appDependencies) createExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.ctxGetUser(r)
+
+	inProgress, err := a.exportModel.InProgress(user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(!inProgress, "export", "an export is already being prepared, you will get an email when it is ready")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	job := &data.Export{
+		UserID: user.ID,
+		Status: data.ExportPending,
+	}
+	err = a.exportModel.Insert(job)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	// the background job gets its own copy so it never races with the response below
+	running := *job
+	email := user.Email
+	a.background(func() {
+		a.runExport(&running, email)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/exports/%d", job.ID))
+	data := envelope{
+		"export": job,
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display the status of one of the current user's exports */
+func (a *appDependencies) displayExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	job, err := a.exportModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if job.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	data := envelope{
+		"export": job,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Download a finished export using the token from the email, so the link works without logging in. The archive is thrown away once it has been sent */
+func (a *appDependencies) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	plaintext := r.URL.Query().Get("token")
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, plaintext)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetForToken(data.ScopeExport, plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired download token")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	job, err := a.exportModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if job.UserID != user.ID {
+		a.notFound(w, r)
+		return
+	}
+
+	archive, err := a.exportModel.GetArchive(job.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bookclub-export-%d.zip"`, job.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(archive)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+		return
+	}
+
+	err = a.exportModel.Expire(job.ID)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+	}
+}
+
+/* Put an export together and email the user a link to it */
+func (a *appDependencies) runExport(job *data.Export, email string) {
+	job.Status = data.ExportRunning
+	err := a.exportModel.Update(job)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+	}
+
+	job.Archive, err = a.buildExport(job.UserID)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+		job.Status = data.ExportFailed
+		job.Error = "the export could not be put together because of a server error"
+	} else {
+		job.Status = data.ExportCompleted
+	}
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+
+	err = a.exportModel.Update(job)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+		return
+	}
+	if job.Status != data.ExportCompleted {
+		return
+	}
+
+	token, err := a.tokenModel.New(job.UserID, data.ExportTTL, data.ScopeExport)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+		return
+	}
+
+	mail := map[string]any{
+		"exportID":      job.ID,
+		"downloadToken": token.Plaintext,
+	}
+	err = a.mailer.Send(email, "data_export.tmpl", mail)
+	if err != nil {
+		a.logger.Error(err.Error(), "export", job.ID)
+	}
+}
+
+/* Write each section of a user's data to its own JSON file in a ZIP */
+func (a *appDependencies) buildExport(userID int64) ([]byte, error) {
+	sections, err := a.exportModel.Collect(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf, pretty bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, name := range names {
+		file, err := archive.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		err = json.Indent(&pretty, sections[name], "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		_, err = pretty.WriteTo(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
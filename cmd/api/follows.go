@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Follow a user, their activity shows up in the current user's feed */
+func (a *appDependencies) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	follow := &data.Follow{
+		FollowerID: a.ctxGetUser(r).ID,
+		FolloweeID: id,
+	}
+
+	v := validator.New()
+	v.Check(follow.FollowerID != follow.FolloweeID, "user", "you can't follow yourself")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if user.Hidden {
+		a.notFound(w, r)
+		return
+	}
+
+	err = a.followModel.Insert(follow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFollow):
+			v.AddError("user", "you are already following this user")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"follow": follow,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Stop following a user */
+func (a *appDependencies) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	err = a.followModel.Delete(a.ctxGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "user unfollowed",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* List the users following a user */
+func (a *appDependencies) listFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	a.listFollows(w, r, "followers", a.followModel.GetFollowers)
+}
+
+/* List the users a user follows */
+func (a *appDependencies) listFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	a.listFollows(w, r, "following", a.followModel.GetFollowing)
+}
+
+func (a *appDependencies) listFollows(w http.ResponseWriter, r *http.Request, key string, get func(int64, data.Filters) ([]*data.PublicUser, data.Metadata, error)) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	v := validator.New()
+	queryParametersData.Filters.Sort = "id"
+	queryParametersData.Filters.SortSafeList = []string{"id"}
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 25, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if user.Hidden && !a.canSeeHidden(r, user.ID) {
+		a.notFound(w, r)
+		return
+	}
+
+	users, metadata, err := get(user.ID, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		key:         users,
+		"@metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Show the current user what the people they follow have been up to, newest first */
+func (a *appDependencies) feedHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	v := validator.New()
+	queryParametersData.Filters.Sort = "-created_at"
+	queryParametersData.Filters.SortSafeList = []string{"-created_at"}
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 20, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := a.eventModel.GetFeed(a.ctxGetUser(r).ID, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"events":    events,
+		"@metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
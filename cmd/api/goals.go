@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Create a new reading goal for the current user */
+func (a *appDependencies) createGoalHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Year   int    `json:"year"`
+		Target int    `json:"target"`
+		Genre  string `json:"genre"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	goal := &data.Goal{
+		UserID: a.ctxGetUser(r).ID,
+		Year:   incomingData.Year,
+		Target: incomingData.Target,
+		Genre:  incomingData.Genre,
+	}
+	if goal.Year == 0 {
+		goal.Year = time.Now().Year()
+	}
+
+	v := validator.New()
+	data.ValidateGoal(v, goal)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.goalModel.Insert(goal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGoal):
+			v.AddError("goal", "a goal for this year and genre already exists")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	goal, err = a.goalModel.Get(goal.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/goals/%d", goal.ID))
+	data := envelope{
+		"goal": goal,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display a user's reading goals and their progress */
+func (a *appDependencies) listUserGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readUserIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	goals, err := a.goalModel.GetAllForUser(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"goals": goals,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display a reading goal */
+func (a *appDependencies) displayGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	goal, err := a.goalModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"goal": goal,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Update one of the current user's reading goals */
+func (a *appDependencies) updateGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	goal, err := a.goalModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if goal.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Year   *int    `json:"year"`
+		Target *int    `json:"target"`
+		Genre  *string `json:"genre"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	if incomingData.Year != nil {
+		goal.Year = *incomingData.Year
+	}
+	if incomingData.Target != nil {
+		goal.Target = *incomingData.Target
+	}
+	if incomingData.Genre != nil {
+		goal.Genre = *incomingData.Genre
+	}
+
+	v := validator.New()
+	data.ValidateGoal(v, goal)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.goalModel.Update(goal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGoal):
+			v.AddError("goal", "a goal for this year and genre already exists")
+			a.failedValidation(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflict(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	goal, err = a.goalModel.Get(goal.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"goal": goal,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Delete one of the current user's reading goals */
+func (a *appDependencies) deleteGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	goal, err := a.goalModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if goal.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	err = a.goalModel.Delete(goal.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "goal successfully deleted",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
@@ -109,6 +109,20 @@ func (a *appDependencies) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+/* Read a user ID from the URL, where "me" stands for the current user */
+func (a *appDependencies) readUserIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	if params.ByName("id") == "me" {
+		user := a.ctxGetUser(r)
+		if user.IsAnon() {
+			return 0, errors.New("invalid id parameter")
+		}
+		return user.ID, nil
+	}
+
+	return a.readIDParam(r)
+}
+
 func (a *appDependencies) getSingleQueryParameters(queryParameters url.Values, key string, defaultValue string) string {
 	result := queryParameters.Get(key)
 	if result == "" {
@@ -133,6 +147,21 @@ func (a *appDependencies) getSingleIntegerParameters(queryParameters url.Values,
 	return intValue
 }
 
+func (a *appDependencies) getOptionalBoolParameters(queryParameters url.Values, key string, v *validator.Validator) *bool {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &boolValue
+}
+
 func (a *appDependencies) background(fn func()) {
 	a.wg.Add(1)
 	go func() {
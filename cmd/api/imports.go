@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/importer"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* The genre given to books an import has to create, since library exports don't say */
+const importedGenre = "Uncategorised"
+
+/* Start importing a Goodreads or StoryGraph CSV export for the current user */
+func (a *appDependencies) createImportHandler(w http.ResponseWriter, r *http.Request) {
+	maxBytes := int64(10 << 20)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	// the export can be sent as the raw request body or as the "file" field of a form upload
+	var file io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		upload, _, err := r.FormFile("file")
+		if err != nil {
+			a.badRequest(w, r, fmt.Errorf("the form must contain the export in a \"file\" field"))
+			return
+		}
+		defer upload.Close()
+		file = upload
+	}
+
+	source, entries, err := importer.Parse(file)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			a.badRequest(w, r, fmt.Errorf("the file must not be larger than %d bytes", maxBytesErr.Limit))
+		case errors.Is(err, importer.ErrUnknownFormat):
+			a.badRequest(w, r, err)
+		default:
+			a.badRequest(w, r, fmt.Errorf("the file could not be read as CSV: %w", err))
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(entries) > 0, "file", "must contain at least one book")
+	v.Check(len(entries) <= 10000, "file", "must not contain more than 10000 books")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	job := &data.Import{
+		UserID: a.ctxGetUser(r).ID,
+		Source: source,
+		Status: data.ImportPending,
+		Total:  len(entries),
+	}
+	err = a.importModel.Insert(job)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	// the background job gets its own copy so it never races with the response below
+	running := *job
+	a.background(func() {
+		a.runImport(&running, entries)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/imports/%d", job.ID))
+	data := envelope{
+		"import": job,
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display the status of one of the current user's imports */
+func (a *appDependencies) displayImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	job, err := a.importModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if job.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	data := envelope{
+		"import": job,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Work through the entries of an import, saving progress as we go so it can be polled */
+func (a *appDependencies) runImport(job *data.Import, entries []importer.Entry) {
+	job.Status = data.ImportRunning
+	err := a.importModel.Update(job)
+	if err != nil {
+		a.logger.Error(err.Error(), "import", job.ID)
+	}
+
+	shelves := make(map[string]int64)
+	for i, entry := range entries {
+		err = a.importEntry(job, entry, shelves)
+		if err != nil {
+			a.logger.Error(err.Error(), "import", job.ID)
+			job.Status = data.ImportFailed
+			job.Error = fmt.Sprintf("the import stopped after %d books because of a server error", i)
+			break
+		}
+
+		job.Processed = i + 1
+		if job.Processed%25 == 0 {
+			err = a.importModel.Update(job)
+			if err != nil {
+				a.logger.Error(err.Error(), "import", job.ID)
+			}
+		}
+	}
+
+	if job.Status != data.ImportFailed {
+		job.Status = data.ImportCompleted
+	}
+
+	// the books themselves were added without feed events, so followers see the import once
+	err = a.eventModel.InsertImport(job.UserID, job.Processed-job.Skipped)
+	if err != nil {
+		a.logger.Error(err.Error(), "import", job.ID)
+	}
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+
+	err = a.importModel.Update(job)
+	if err != nil {
+		a.logger.Error(err.Error(), "import", job.ID)
+	}
+}
+
+/* Import one book: find or create it, shelve it, and carry over the rating, review and read date */
+func (a *appDependencies) importEntry(job *data.Import, entry importer.Entry, shelves map[string]int64) error {
+	book, err := a.matchOrCreateBook(job, entry)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			job.Skipped++
+			return nil
+		}
+		return err
+	}
+
+	for _, shelf := range entry.Shelves {
+		listID, ok := shelves[shelf]
+		if !ok {
+			listID, err = a.importShelf(job, shelf)
+			if err != nil {
+				return err
+			}
+			shelves[shelf] = listID
+		}
+		if listID == 0 {
+			continue
+		}
+
+		_, err = a.listModel.WithoutEvents().AddBooks(listID, []data.BookRef{{BookID: book.ID}})
+		if err != nil {
+			return err
+		}
+	}
+
+	// reviews are held to the same rules as ones written here, so a rating without any text isn't
+	// imported. Importing again replaces the review rather than adding a second one
+	if entry.Rating > 0 && entry.Review != "" {
+		review := &data.Review{
+			BookID: book.ID,
+			UserID: job.UserID,
+			Rating: entry.Rating,
+			Desc:   truncate(entry.Review, a.config.reviews.maxLength),
+		}
+
+		v := validator.New()
+		data.ValidateReview(v, a.screener, a.config.reviews.maxLength, review)
+		if v.IsEmpty() {
+			_, err = a.reviewModel.WithoutEvents().Upsert(review)
+			if err != nil {
+				return err
+			}
+			a.flagForModeration(v, "review", review.ID)
+			job.ReviewsImported++
+		}
+	}
+
+	if !entry.DateRead.IsZero() {
+		finished := &data.FinishedBook{
+			UserID:     job.UserID,
+			BookID:     book.ID,
+			FinishedAt: entry.DateRead,
+		}
+		err = a.finishedBookModel.WithoutEvents().Insert(finished)
+		if err != nil {
+			return err
+		}
+		job.ReadsImported++
+	}
+
+	return nil
+}
+
+/* Find an entry's book by ISBN, then by title and author, and only create it when it would pass the same validation as a new book */
+func (a *appDependencies) matchOrCreateBook(job *data.Import, entry importer.Entry) (*data.Book, error) {
+	if entry.ISBN != "" {
+		book, err := a.bookModel.GetByISBN(entry.ISBN)
+		if err == nil {
+			job.BooksMatched++
+			return book, nil
+		}
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if entry.Author != "" {
+		book, err := a.bookModel.GetByTitleAuthor(entry.Title, entry.Author)
+		if err == nil {
+			job.BooksMatched++
+			return book, nil
+		}
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if entry.ISBN == "" || entry.Author == "" {
+		return nil, data.ErrRecordNotFound
+	}
+
+	// exports don't have a genre or description and a book can't be created without them, or without
+	// a rating, so the reader's own rating stands in until others review it
+	book := &data.Book{
+		Title:     truncate(entry.Title, 100),
+		Author:    truncate(entry.Author, 255),
+		ISBN:      entry.ISBN,
+		Genre:     importedGenre,
+		Desc:      fmt.Sprintf("Imported from %s", job.Source),
+		AvgRating: entry.Rating,
+	}
+	if entry.PubYear > 0 {
+		book.PubDate = time.Date(entry.PubYear, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	v := validator.New()
+	data.ValidateBook(v, book)
+	v.Check(!book.PubDate.IsZero(), "book", "must have a publication year")
+	if !v.IsEmpty() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	err := a.bookModel.Insert(book)
+	if err != nil {
+		return nil, err
+	}
+	job.BooksCreated++
+
+	return book, nil
+}
+
+/* Find the list an imported shelf goes on, reusing the user's list of the same name so importing again doesn't duplicate it. A shelf whose name doesn't pass validation is skipped, which is reported as list 0 */
+func (a *appDependencies) importShelf(job *data.Import, shelf string) (int64, error) {
+	name := truncate(shelf, 100)
+
+	list, err := a.listModel.GetByName(job.UserID, name)
+	if err == nil {
+		return list.ID, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	list = &data.List{
+		Name:   name,
+		Desc:   fmt.Sprintf("Imported from %s", job.Source),
+		UserID: job.UserID,
+		Kind:   data.ListManual,
+		Status: "reading",
+	}
+	if shelf == "read" {
+		list.Status = "finished"
+	}
+
+	v := validator.New()
+	data.ValidateList(v, a.screener, list)
+	if !v.IsEmpty() {
+		return 0, nil
+	}
+
+	err = a.listModel.WithoutEvents().Insert(list)
+	if err != nil {
+		return 0, err
+	}
+	a.flagForModeration(v, "list", list.ID)
+	job.ListsCreated++
+
+	return list.ID, nil
+}
+
+/* Shorten text to at most n bytes without splitting a character */
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
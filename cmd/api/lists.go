@@ -9,14 +9,15 @@ import (
 	"github.com/thats-insane/awt-final/internal/validator"
 )
 
-/* Create a new list */
+/* Create a new list owned by the current user */
 func (a *appDependencies) createListHandler(w http.ResponseWriter, r *http.Request) {
 	var incomingData struct {
-		Name       string `json:"name"`
-		Desc       string `json:"desc"`
-		UserID     int64  `json:"user_id"`
-		BookListID int64  `json:"books"`
-		Status     string `json:"status"`
+		Name       string          `json:"name"`
+		Desc       string          `json:"desc"`
+		BookListID int64           `json:"books"`
+		Status     string          `json:"status"`
+		Kind       string          `json:"kind"`
+		Query      *data.BookQuery `json:"query"`
 	}
 	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
@@ -24,16 +25,22 @@ func (a *appDependencies) createListHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	user := a.ctxGetUser(r)
 	list := &data.List{
 		Name:       incomingData.Name,
 		Desc:       incomingData.Desc,
-		UserID:     incomingData.UserID,
+		UserID:     user.ID,
 		BookListID: incomingData.BookListID,
 		Status:     incomingData.Status,
+		Kind:       incomingData.Kind,
+		Query:      incomingData.Query,
+	}
+	if list.Kind == "" {
+		list.Kind = data.ListManual
 	}
 
 	v := validator.New()
-	data.ValidateList(v, list)
+	data.ValidateList(v, a.screener, list)
 	if !v.IsEmpty() {
 		a.failedValidation(w, r, v.Errors)
 		return
@@ -45,6 +52,9 @@ func (a *appDependencies) createListHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	a.recordPost(user.ID)
+	a.flagForModeration(v, "list", list.ID)
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("api/v1/list/%d", list.ID))
 	data := envelope{
@@ -54,10 +64,7 @@ func (a *appDependencies) createListHandler(w http.ResponseWriter, r *http.Reque
 	err = a.writeJSON(w, http.StatusCreated, data, headers)
 	if err != nil {
 		a.serverErr(w, r, err)
-		return
 	}
-
-	fmt.Fprintf(w, "%+v\n", incomingData)
 }
 
 /* Select all lists */
@@ -94,45 +101,74 @@ func (a *appDependencies) listListsHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-/* Add a new book to reading list */
+/* Add one or more books to a reading list. Books already on it or not found are skipped and the rest are added, with a result for each book */
 func (a *appDependencies) addBookToListHandler(w http.ResponseWriter, r *http.Request) {
-	var incomingData struct {
-		ListID int64 `json:"list_id"`
-		BookID int64 `json:"book_id"`
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
 	}
 
-	err := a.readJSON(w, r, &incomingData)
+	var incomingData struct {
+		BookIDs []int64  `json:"book_ids"`
+		ISBNs   []string `json:"isbns"`
+	}
+	err = a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequest(w, r, err)
 		return
 	}
 
-	booklist := &data.BookList{
-		ListID: incomingData.ListID,
-		BookID: incomingData.BookID,
+	refs := bookRefs(incomingData.BookIDs, incomingData.ISBNs)
+	v := validator.New()
+	data.ValidateBookRefs(v, refs)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	list, err := a.listModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if list.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	if list.Kind == data.ListSmart {
+		v.AddError("list", "the books of a smart list come from its query and can't be changed directly")
+		a.failedValidation(w, r, v.Errors)
+		return
 	}
-	err = a.listModel.AddBook(booklist)
+
+	results, err := a.listModel.AddBooks(list.ID, refs)
 	if err != nil {
 		a.serverErr(w, r, err)
 		return
 	}
 
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d/books", booklist.ID))
+	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d", list.ID))
 	data := envelope{
-		"booklist": booklist,
+		"results": results,
+		"summary": summarizeBookListResults(results),
 	}
 
-	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErr(w, r, err)
-		return
 	}
-
-	fmt.Fprintf(w, "%+v\n", incomingData)
 }
 
-/* Select one reading list */
+/* Select one reading list, smart lists also get the books their query currently matches */
 func (a *appDependencies) displayListHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -151,18 +187,62 @@ func (a *appDependencies) displayListHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if list.Hidden && !a.canSeeHidden(r, list.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	if list.Kind != data.ListSmart || list.Query == nil {
+		data := envelope{
+			"list": list,
+		}
+
+		err = a.writeJSON(w, http.StatusOK, data, nil)
+		if err != nil {
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	defaultSort := list.Query.Sort
+	if defaultSort == "" {
+		defaultSort = "title"
+	}
+
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", defaultSort)
+	queryParametersData.Filters.SortSafeList = data.BookSortSafeList
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := a.bookModel.Query(list.Query, list.UserID, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
 	data := envelope{
-		"list": list,
+		"list":      list,
+		"books":     books,
+		"@metadata": metadata,
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErr(w, r, err)
-		return
 	}
 }
 
-/* Update a reading list */
+/* Update one of the current user's reading lists */
 func (a *appDependencies) updateListHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -181,12 +261,17 @@ func (a *appDependencies) updateListHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if list.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
 	var incomingData struct {
-		Name       *string `json:"name"`
-		Desc       *string `json:"desc"`
-		UserID     *int64  `json:"user_id"`
-		BookListID *int64  `json:"books"`
-		Status     *string `json:"status"`
+		Name       *string         `json:"name"`
+		Desc       *string         `json:"desc"`
+		BookListID *int64          `json:"books"`
+		Status     *string         `json:"status"`
+		Query      *data.BookQuery `json:"query"`
 	}
 
 	err = a.readJSON(w, r, &incomingData)
@@ -201,18 +286,18 @@ func (a *appDependencies) updateListHandler(w http.ResponseWriter, r *http.Reque
 	if incomingData.Desc != nil {
 		list.Desc = *incomingData.Desc
 	}
-	if incomingData.UserID != nil {
-		list.UserID = *incomingData.UserID
-	}
 	if incomingData.BookListID != nil {
 		list.BookListID = *incomingData.BookListID
 	}
 	if incomingData.Status != nil {
 		list.Status = *incomingData.Status
 	}
+	if incomingData.Query != nil {
+		list.Query = incomingData.Query
+	}
 
 	v := validator.New()
-	data.ValidateList(v, list)
+	data.ValidateList(v, a.screener, list)
 	if !v.IsEmpty() {
 		a.failedValidation(w, r, v.Errors)
 		return
@@ -224,6 +309,8 @@ func (a *appDependencies) updateListHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	a.flagForModeration(v, "list", list.ID)
+
 	data := envelope{
 		"list": list,
 	}
@@ -235,7 +322,7 @@ func (a *appDependencies) updateListHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-/* Delete a reading list */
+/* Delete one of the current user's reading lists */
 func (a *appDependencies) deleteListHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -243,7 +330,23 @@ func (a *appDependencies) deleteListHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = a.listModel.Delete(id)
+	list, err := a.listModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if list.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	err = a.listModel.Delete(list.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -264,7 +367,7 @@ func (a *appDependencies) deleteListHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
-/* Delete a book from a reading list */
+/* Remove one or more books from a reading list. Books not on it or not found are skipped and the rest are removed, with a result for each book */
 func (a *appDependencies) deleteBookFromListHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -272,7 +375,25 @@ func (a *appDependencies) deleteBookFromListHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	err = a.listModel.DeleteBook(id)
+	var incomingData struct {
+		BookIDs []int64  `json:"book_ids"`
+		ISBNs   []string `json:"isbns"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	refs := bookRefs(incomingData.BookIDs, incomingData.ISBNs)
+	v := validator.New()
+	data.ValidateBookRefs(v, refs)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	list, err := a.listModel.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -283,8 +404,26 @@ func (a *appDependencies) deleteBookFromListHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	if list.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
+	if list.Kind == data.ListSmart {
+		v.AddError("list", "the books of a smart list come from its query and can't be changed directly")
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	results, err := a.listModel.RemoveBooks(list.ID, refs)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
 	data := envelope{
-		"message": "book successfully deleted from list",
+		"results": results,
+		"summary": summarizeBookListResults(results),
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -292,3 +431,105 @@ func (a *appDependencies) deleteBookFromListHandler(w http.ResponseWriter, r *ht
 		a.serverErr(w, r, err)
 	}
 }
+
+/* Combine the book IDs and ISBNs of a bulk request into one list of references */
+func bookRefs(bookIDs []int64, isbns []string) []data.BookRef {
+	refs := []data.BookRef{}
+	for _, id := range bookIDs {
+		refs = append(refs, data.BookRef{BookID: id})
+	}
+	for _, isbn := range isbns {
+		refs = append(refs, data.BookRef{ISBN: isbn})
+	}
+
+	return refs
+}
+
+/* Count how many books of a bulk request ended up in each state */
+func summarizeBookListResults(results []*data.BookListResult) map[string]int {
+	summary := make(map[string]int)
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	return summary
+}
+
+/* Fork a reading list into a new list owned by the current user */
+func (a *appDependencies) forkListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Name *string `json:"name"`
+		Desc *string `json:"desc"`
+	}
+	if r.ContentLength != 0 {
+		err = a.readJSON(w, r, &incomingData)
+		if err != nil {
+			a.badRequest(w, r, err)
+			return
+		}
+	}
+
+	source, err := a.listModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if source.Hidden && !a.canSeeHidden(r, source.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	fork := &data.List{
+		Name:       source.Name,
+		Desc:       source.Desc,
+		UserID:     a.ctxGetUser(r).ID,
+		BookListID: source.BookListID,
+		Status:     "reading",
+		Kind:       source.Kind,
+		Query:      source.Query,
+	}
+	if incomingData.Name != nil {
+		fork.Name = *incomingData.Name
+	}
+	if incomingData.Desc != nil {
+		fork.Desc = *incomingData.Desc
+	}
+
+	v := validator.New()
+	data.ValidateList(v, a.screener, fork)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.listModel.Fork(source, fork)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.flagForModeration(v, "list", fork.ID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/lists/%d", fork.ID))
+	data := envelope{
+		"list": fork,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +15,9 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/thats-insane/awt-final/internal/data"
 	"github.com/thats-insane/awt-final/internal/mailer"
+	"github.com/thats-insane/awt-final/internal/screening"
+	"github.com/thats-insane/awt-final/internal/validator"
+	"golang.org/x/time/rate"
 )
 
 const appVersion = "1.0.0"
@@ -38,18 +43,58 @@ type serverConfig struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	screening struct {
+		config string
+	}
+	reviews struct {
+		maxLength int
+	}
+	accounts struct {
+		deletionPolicy string
+	}
+	login struct {
+		maxFailures   int
+		ipMaxFailures int
+		lockout       time.Duration
+	}
+	mfa struct {
+		requiredUsers []int64
+	}
+	tokens struct {
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	activation struct {
+		resendInterval time.Duration
+		resendBurst    int
+	}
 }
 
 type appDependencies struct {
-	config      serverConfig
-	logger      *slog.Logger
-	userModel   data.UserModel
-	bookModel   data.BookModel
-	reviewModel data.ReviewModel
-	listModel   data.ListModel
-	tokenModel  data.TokenModel
-	mailer      mailer.Mailer
-	wg          sync.WaitGroup
+	config            serverConfig
+	logger            *slog.Logger
+	userModel         data.UserModel
+	bookModel         data.BookModel
+	reviewModel       data.ReviewModel
+	listModel         data.ListModel
+	tokenModel        data.TokenModel
+	permissionModel   data.PermissionModel
+	loginModel        data.LoginModel
+	mfaModel          data.MFAModel
+	finishedBookModel data.FinishedBookModel
+	goalModel         data.GoalModel
+	challengeModel    data.ChallengeModel
+	importModel       data.ImportModel
+	exportModel       data.ExportModel
+	followModel       data.FollowModel
+	eventModel        data.EventModel
+	commentModel      data.CommentModel
+	reportModel       data.ReportModel
+	moderationModel   data.ModerationModel
+	activationLimiter *keyedLimiter
+	screener          *screening.Screener
+	mailer            mailer.Mailer
+	wg                sync.WaitGroup
 }
 
 func openDB(settings serverConfig) (*sql.DB, error) {
@@ -89,9 +134,38 @@ func main() {
 		settings.cors.trustedOrigins = strings.Fields(s)
 		return nil
 	})
+	flag.StringVar(&settings.screening.config, "screening-config", "", "Text screening rules file (leave empty to turn screening off)")
+	flag.IntVar(&settings.reviews.maxLength, "review-max-length", 10000, "Longest review body allowed, in bytes")
+	flag.StringVar(&settings.accounts.deletionPolicy, "deletion-policy", data.DeletionAnonymize, "What happens to a deleted account's reviews and lists (anonymize|delete)")
+	flag.IntVar(&settings.login.maxFailures, "login-max-failures", 5, "Failed logins before an account is locked")
+	flag.IntVar(&settings.login.ipMaxFailures, "login-ip-max-failures", 20, "Failed logins before a client IP is locked")
+	flag.DurationVar(&settings.login.lockout, "login-lockout", 15*time.Minute, "How long a locked account or IP has to wait")
+	flag.DurationVar(&settings.tokens.accessTTL, "access-token-ttl", 15*time.Minute, "How long an access token lasts")
+	flag.DurationVar(&settings.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "How long a session can be refreshed for, counted from when the user logged in")
+	flag.DurationVar(&settings.activation.resendInterval, "activation-resend-interval", 5*time.Minute, "How often activation emails can be resent to one address, separate from the request rate limiter")
+	flag.IntVar(&settings.activation.resendBurst, "activation-resend-burst", 2, "Activation emails that can be resent to one address at once")
+	flag.Func("mfa-required-users", "User IDs that must use two-factor authentication (space separated)", func(s string) error {
+		for _, field := range strings.Fields(s) {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || id < 1 {
+				return fmt.Errorf("invalid user ID %q", field)
+			}
+			settings.mfa.requiredUsers = append(settings.mfa.requiredUsers, id)
+		}
+		return nil
+	})
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	if !validator.PermittedValue(settings.accounts.deletionPolicy, data.DeletionAnonymize, data.DeletionRemove) {
+		logger.Error("deletion-policy must be either anonymize or delete")
+		os.Exit(1)
+	}
+	if settings.activation.resendInterval <= 0 || settings.activation.resendBurst < 1 {
+		logger.Error("activation-resend-interval and activation-resend-burst must be positive")
+		os.Exit(1)
+	}
+
 	db, err := openDB(settings)
 	if err != nil {
 		logger.Error(err.Error())
@@ -100,15 +174,40 @@ func main() {
 	defer db.Close()
 	logger.Info("database connection pool established")
 
+	var screener *screening.Screener
+	if settings.screening.config != "" {
+		screener, err = screening.New(settings.screening.config)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.Info("text screening rules loaded", "config", settings.screening.config)
+	}
+
 	appInstance := &appDependencies{
-		config:      settings,
-		logger:      logger,
-		userModel:   data.UserModel{DB: db},
-		bookModel:   data.BookModel{DB: db},
-		reviewModel: data.ReviewModel{DB: db},
-		listModel:   data.ListModel{DB: db},
-		tokenModel:  data.TokenModel{DB: db},
-		mailer:      mailer.New(settings.smtp.host, settings.smtp.port, settings.smtp.username, settings.smtp.password, settings.smtp.sender),
+		config:            settings,
+		logger:            logger,
+		userModel:         data.UserModel{DB: db},
+		bookModel:         data.BookModel{DB: db},
+		reviewModel:       data.ReviewModel{DB: db},
+		listModel:         data.ListModel{DB: db},
+		tokenModel:        data.TokenModel{DB: db},
+		permissionModel:   data.PermissionModel{DB: db},
+		loginModel:        data.LoginModel{DB: db},
+		mfaModel:          data.MFAModel{DB: db},
+		finishedBookModel: data.FinishedBookModel{DB: db},
+		goalModel:         data.GoalModel{DB: db},
+		challengeModel:    data.ChallengeModel{DB: db},
+		importModel:       data.ImportModel{DB: db},
+		exportModel:       data.ExportModel{DB: db},
+		followModel:       data.FollowModel{DB: db},
+		eventModel:        data.EventModel{DB: db},
+		commentModel:      data.CommentModel{DB: db},
+		reportModel:       data.ReportModel{DB: db},
+		moderationModel:   data.ModerationModel{DB: db},
+		activationLimiter: newKeyedLimiter(rate.Every(settings.activation.resendInterval), settings.activation.resendBurst),
+		screener:          screener,
+		mailer:            mailer.New(settings.smtp.host, settings.smtp.port, settings.smtp.username, settings.smtp.password, settings.smtp.sender),
 	}
 
 	err = appInstance.serve()
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/totp"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* The name authenticator apps show next to our codes */
+const totpIssuer = "Book Club"
+
+/* Check whether the server config makes two-factor authentication mandatory for a user */
+func (a *appDependencies) mfaRequired(user *data.User) bool {
+	return slices.Contains(a.config.mfa.requiredUsers, user.ID)
+}
+
+/* Check a second factor, either a TOTP code or one of the user's recovery codes. Both can only be used once */
+func (a *appDependencies) checkSecondFactor(user *data.User, code string, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return a.mfaModel.UseRecoveryCode(user.ID, recoveryCode)
+	}
+
+	mfa, err := a.mfaModel.Get(user.ID)
+	if err != nil {
+		return false, err
+	}
+	if !mfa.Enabled {
+		return false, nil
+	}
+
+	step, ok := totp.Validate(mfa.Secret, code, time.Now(), mfa.LastStep)
+	if !ok {
+		return false, nil
+	}
+	return a.mfaModel.UseStep(user.ID, step)
+}
+
+/* Start setting up two-factor authentication, returning a new secret and the URI to load it into an authenticator app */
+func (a *appDependencies) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password string `json:"password"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentials(w, r)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	err = a.mfaModel.SetSecret(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("2fa", "two-factor authentication is already turned on")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"secret":          secret,
+		"provisioningUri": totp.URI(totpIssuer, user.Email, secret),
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Turn on two-factor authentication with the first code from the authenticator app, returning recovery codes that are never shown again */
+func (a *appDependencies) confirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Code string `json:"code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Code != "", "code", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	mfa, err := a.mfaModel.Get(user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	v.Check(!mfa.Enabled, "2fa", "two-factor authentication is already turned on")
+	v.Check(mfa.Secret != "", "2fa", "two-factor authentication has to be set up first")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	step, ok := totp.Validate(mfa.Secret, incomingData.Code, time.Now(), mfa.LastStep)
+	if !ok {
+		v.AddError("code", "invalid code")
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	codes, hashes, err := data.GenerateRecoveryCodes()
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	err = a.mfaModel.Enable(user.ID, step, hashes)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("2fa", "two-factor authentication is already turned on")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message":       "two-factor authentication is now turned on, keep these recovery codes somewhere safe",
+		"recoveryCodes": codes,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Turn off two-factor authentication, which needs the password and a code. Accounts the server config requires it for can't */
+func (a *appDependencies) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	v.Check((incomingData.Code == "") != (incomingData.RecoveryCode == ""), "code", "must provide either a code or a recovery code")
+	v.Check(!a.mfaRequired(user), "2fa", "two-factor authentication is required for this account")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentials(w, r)
+		return
+	}
+
+	match, err = a.checkSecondFactor(user, incomingData.Code, incomingData.RecoveryCode)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentials(w, r)
+		return
+	}
+
+	err = a.mfaModel.Disable(user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "two-factor authentication is now turned off",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
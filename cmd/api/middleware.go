@@ -78,6 +78,60 @@ func (a *appDependencies) rateLimit(next http.Handler) http.Handler {
 	})
 }
 
+/* Rate limits keyed on something other than the client IP, like the email address a handler is about to send mail to */
+type keyedLimiter struct {
+	mux     sync.Mutex
+	limit   rate.Limit
+	burst   int
+	idle    time.Duration
+	clients map[string]*keyedClient
+}
+
+type keyedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newKeyedLimiter(limit rate.Limit, burst int) *keyedLimiter {
+	l := &keyedLimiter{
+		limit:   limit,
+		burst:   burst,
+		clients: make(map[string]*keyedClient),
+	}
+	// after this long without a request a limiter has filled back up, so it can be dropped
+	l.idle = time.Duration(float64(burst) / float64(limit) * float64(time.Second))
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			l.mux.Lock()
+
+			for key, client := range l.clients {
+				if time.Since(client.lastSeen) > l.idle {
+					delete(l.clients, key)
+				}
+			}
+			l.mux.Unlock()
+		}
+	}()
+
+	return l
+}
+
+/* Check whether another request is allowed for a key */
+func (l *keyedLimiter) Allow(key string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	_, found := l.clients[key]
+	if !found {
+		l.clients[key] = &keyedClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+	}
+
+	l.clients[key].lastSeen = time.Now()
+	return l.clients[key].limiter.Allow()
+}
+
 /* Authenticate a user using the token */
 func (a *appDependencies) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -114,13 +168,35 @@ func (a *appDependencies) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		err = a.tokenModel.Touch(token)
+		if err != nil {
+			a.serverErr(w, r, err)
+			return
+		}
+
 		r = a.ctxSetUser(r, user)
+		r = a.ctxSetToken(r, token)
 		next.ServeHTTP(w, r)
 	})
 }
 
-/* Check if user is authenticated (not anonymous) */
+/* Check if user is authenticated (not anonymous), and has two-factor authentication on if the server config requires it */
 func (a *appDependencies) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := a.ctxGetUser(r)
+
+		// accounts that must use two-factor authentication can only reach the setup endpoints until it is on
+		if a.mfaRequired(user) && !user.MFAEnabled {
+			a.mfaSetupRequired(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return a.requireAuthForMFASetup(fn)
+}
+
+/* Check if user is authenticated, even if they still have to turn on two-factor authentication. Only for setting it up and logging out */
+func (a *appDependencies) requireAuthForMFASetup(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := a.ctxGetUser(r)
 
@@ -142,11 +218,32 @@ func (a *appDependencies) requireActivated(next http.HandlerFunc) http.HandlerFu
 			a.inactiveAccount(w, r)
 			return
 		}
+
 		next.ServeHTTP(w, r)
 	})
 	return a.requireAuth(fn)
 }
 
+/* Check if user has been granted a permission */
+func (a *appDependencies) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := a.ctxGetUser(r)
+
+		permissions, err := a.permissionModel.GetAllForUser(user.ID)
+		if err != nil {
+			a.serverErr(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			a.notPermitted(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return a.requireActivated(fn)
+}
+
 func (a *appDependencies) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thats-insane/awt-final/internal/data"
+)
+
+func TestRequireAuthMFA(t *testing.T) {
+	a := &appDependencies{}
+	a.config.mfa.requiredUsers = []int64{1}
+
+	reached := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	tests := []struct {
+		name    string
+		user    *data.User
+		method  string
+		path    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"export without 2fa", &data.User{ID: 1, Activated: true}, http.MethodPost, "/api/v1/users/me/export", a.requireAuth(a.createExportHandler), http.StatusForbidden},
+		{"delete without 2fa", &data.User{ID: 1, Activated: true}, http.MethodDelete, "/api/v1/users/me", a.requireAuth(a.deleteCurrentUserHandler), http.StatusForbidden},
+		{"activated route without 2fa", &data.User{ID: 1, Activated: true}, http.MethodGet, "/", a.requireActivated(reached), http.StatusForbidden},
+		{"setup without 2fa", &data.User{ID: 1, Activated: true}, http.MethodPost, "/api/v1/users/me/2fa", a.requireAuthForMFASetup(reached), http.StatusTeapot},
+		{"with 2fa", &data.User{ID: 1, Activated: true, MFAEnabled: true}, http.MethodGet, "/", a.requireAuth(reached), http.StatusTeapot},
+		{"not required", &data.User{ID: 2, Activated: true}, http.MethodGet, "/", a.requireAuth(reached), http.StatusTeapot},
+		{"anonymous", data.AnonUser, http.MethodGet, "/", a.requireAuth(reached), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := a.ctxSetUser(httptest.NewRequest(tt.method, tt.path, nil), tt.user)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Check whether a user holds the moderation permission, a failed lookup counts as no */
+func (a *appDependencies) isModerator(user *data.User) bool {
+	if user.IsAnon() {
+		return false
+	}
+
+	permissions, err := a.permissionModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.logger.Error(err.Error(), "user_id", user.ID)
+		return false
+	}
+	return permissions.Include(data.PermissionReviewsModerate)
+}
+
+/* Hidden content is only shown to the person who wrote it and to moderators */
+func (a *appDependencies) canSeeHidden(r *http.Request, ownerID int64) bool {
+	user := a.ctxGetUser(r)
+	return user.ID == ownerID || a.isModerator(user)
+}
+
+/* Count a new post towards the author's posting limits, only once it has been saved */
+func (a *appDependencies) recordPost(userID int64) {
+	if a.screener != nil {
+		a.screener.Record(userID)
+	}
+}
+
+/* Put content that text screening flagged into the moderation queue, it has already been saved so failures are only logged */
+func (a *appDependencies) flagForModeration(v *validator.Validator, targetType string, targetID int64) {
+	for reason, details := range v.Flags {
+		report := &data.Report{
+			TargetType: targetType,
+			TargetID:   targetID,
+			Reason:     reason,
+			Details:    details,
+		}
+
+		err := a.reportModel.Insert(report)
+		if err != nil && !errors.Is(err, data.ErrDuplicateReport) {
+			a.logger.Error(err.Error(), "target_type", targetType, "target_id", targetID)
+		}
+	}
+}
+
+/* Report a review, list, comment or user */
+func (a *appDependencies) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		TargetType string `json:"target_type"`
+		TargetID   int64  `json:"target_id"`
+		Reason     string `json:"reason"`
+		Details    string `json:"details"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	report := &data.Report{
+		ReporterID: a.ctxGetUser(r).ID,
+		TargetType: incomingData.TargetType,
+		TargetID:   incomingData.TargetID,
+		Reason:     incomingData.Reason,
+		Details:    incomingData.Details,
+	}
+
+	v := validator.New()
+	data.ValidateReport(v, report)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	exists, err := a.reportModel.TargetExists(report.TargetType, report.TargetID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	if !exists {
+		v.AddError("target_id", fmt.Sprintf("must be an existing %s", report.TargetType))
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.reportModel.Insert(report)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReport):
+			v.AddError("report", "you have already reported this and it is waiting for a moderator")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"report": report,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* List the moderation queue, open reports first by default */
+func (a *appDependencies) listReportsHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Status     string
+		TargetType string
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	queryParametersData.Status = a.getSingleQueryParameters(queryParameters, "status", data.ReportOpen)
+	queryParametersData.TargetType = a.getSingleQueryParameters(queryParameters, "target_type", "")
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "created_at")
+	queryParametersData.Filters.SortSafeList = []string{"id", "created_at", "-id", "-created_at"}
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 25, v)
+	v.Check(validator.PermittedValue(queryParametersData.Status, data.ReportOpen, data.ReportActioned, data.ReportDismissed, "all"), "status", "must be one of open, actioned, dismissed or all")
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	if queryParametersData.Status == "all" {
+		queryParametersData.Status = ""
+	}
+
+	reports, metadata, err := a.reportModel.GetAll(queryParametersData.Status, queryParametersData.TargetType, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reports":   reports,
+		"@metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Display a report */
+func (a *appDependencies) displayReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	report, err := a.reportModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"report": report,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Triage a report as actioned or dismissed, actioning it can also hide the reported content */
+func (a *appDependencies) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Status string `json:"status"`
+		Hide   bool   `json:"hide"`
+		Note   string `json:"note"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	report, err := a.reportModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.PermittedValue(incomingData.Status, data.ReportActioned, data.ReportDismissed), "status", "must be either actioned or dismissed")
+	v.Check(!incomingData.Hide || incomingData.Status == data.ReportActioned, "hide", "only actioned reports can hide content")
+	v.Check(report.Status == data.ReportOpen, "report", "this report has already been resolved")
+	v.Check(len(incomingData.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	report.Status = incomingData.Status
+	action := &data.ModerationAction{
+		ModeratorID: a.ctxGetUser(r).ID,
+		Action:      data.ActionDismissed,
+		TargetType:  report.TargetType,
+		TargetID:    report.TargetID,
+		ReportID:    &report.ID,
+		Note:        incomingData.Note,
+	}
+	if report.Status == data.ReportActioned {
+		action.Action = data.ActionActioned
+	}
+
+	err = a.moderationModel.Resolve(report, action, incomingData.Hide)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflict(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"report": report,
+		"action": action,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Take a piece of content out of public listings without deleting it */
+func (a *appDependencies) hideContentHandler(w http.ResponseWriter, r *http.Request) {
+	a.setHidden(w, r, true)
+}
+
+/* Put hidden content back into public listings */
+func (a *appDependencies) unhideContentHandler(w http.ResponseWriter, r *http.Request) {
+	a.setHidden(w, r, false)
+}
+
+func (a *appDependencies) setHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	var incomingData struct {
+		TargetType string `json:"target_type"`
+		TargetID   int64  `json:"target_id"`
+		Note       string `json:"note"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	action := &data.ModerationAction{
+		ModeratorID: a.ctxGetUser(r).ID,
+		Action:      data.ActionUnhide,
+		TargetType:  incomingData.TargetType,
+		TargetID:    incomingData.TargetID,
+		Note:        incomingData.Note,
+	}
+	if hidden {
+		action.Action = data.ActionHide
+	}
+
+	v := validator.New()
+	data.ValidateModerationAction(v, action)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.moderationModel.SetHidden(action, hidden)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"action": action,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* List the moderation action log */
+func (a *appDependencies) listModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "-created_at")
+	queryParametersData.Filters.SortSafeList = []string{"created_at", "-created_at"}
+	v := validator.New()
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 25, v)
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	actions, metadata, err := a.moderationModel.GetAll(queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"actions":   actions,
+		"@metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/awt-final/internal/data"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Display the permissions a user holds */
+func (a *appDependencies) listUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := a.readPermissionsUser(w, r)
+	if !ok {
+		return
+	}
+
+	a.writeUserPermissions(w, r, user.ID)
+}
+
+/* Grant permissions to a user */
+func (a *appDependencies) grantPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	user, ok := a.readPermissionsUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePermissions(v, incomingData.Permissions)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.permissionModel.AddForUser(user.ID, incomingData.Permissions...)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.writeUserPermissions(w, r, user.ID)
+}
+
+/* Revoke permissions from a user. Admins can't take users:admin away from themselves, so there is always someone left to grant it back */
+func (a *appDependencies) revokePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	user, ok := a.readPermissionsUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePermissions(v, incomingData.Permissions)
+	if user.ID == a.ctxGetUser(r).ID {
+		v.Check(!data.Permissions(incomingData.Permissions).Include(data.PermissionUsersAdmin), "permissions", "you can't revoke users:admin from yourself")
+	}
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.permissionModel.RemoveForUser(user.ID, incomingData.Permissions...)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.writeUserPermissions(w, r, user.ID)
+}
+
+/* Look up the user named in the URL, writing the error response if there isn't one */
+func (a *appDependencies) readPermissionsUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return nil, false
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func (a *appDependencies) writeUserPermissions(w http.ResponseWriter, r *http.Request, userID int64) {
+	permissions, err := a.permissionModel.GetAllForUser(userID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"user_id":     userID,
+		"permissions": permissions,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
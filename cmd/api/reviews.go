@@ -4,49 +4,73 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/thats-insane/awt-final/internal/data"
 	"github.com/thats-insane/awt-final/internal/validator"
 )
 
-/* Add a new review */
+/* Add the current user's review of a book, each user can only review a book once */
 func (a *appDependencies) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
 	var incomingData struct {
-		BookID    int64     `json:"book_id"`
-		UserID    int64     `json:"user_id"`
-		Rating    int64     `json:"rating"`
-		Desc      string    `json:"desc"`
-		CreatedAt time.Time `json:"-"`
+		Rating     float64         `json:"rating"`
+		SubRatings data.SubRatings `json:"sub_ratings"`
+		Desc       string          `json:"body_markdown"`
+		Spoiler    bool            `json:"spoiler"`
 	}
-	err := a.readJSON(w, r, &incomingData)
+	err = a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequest(w, r, err)
 		return
 	}
 
 	review := &data.Review{
-		BookID:    incomingData.BookID,
-		UserID:    incomingData.UserID,
-		Rating:    incomingData.Rating,
-		Desc:      incomingData.Desc,
-		CreatedAt: incomingData.CreatedAt,
+		BookID:     bookID,
+		UserID:     a.ctxGetUser(r).ID,
+		Rating:     incomingData.Rating,
+		SubRatings: incomingData.SubRatings,
+		Desc:       incomingData.Desc,
+		Spoiler:    incomingData.Spoiler,
 	}
 	v := validator.New()
-	data.ValidateReview(v, review)
+	data.ValidateReview(v, a.screener, a.config.reviews.maxLength, review)
 	if !v.IsEmpty() {
 		a.failedValidation(w, r, v.Errors)
 		return
 	}
 
+	_, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
 	err = a.reviewModel.Insert(review)
 	if err != nil {
-		a.serverErr(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.duplicateReview(w, r, bookID, review.UserID)
+		default:
+			a.serverErr(w, r, err)
+		}
 		return
 	}
 
+	a.recordPost(review.UserID)
+	a.flagForModeration(v, "review", review.ID)
+
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("api/v1/review/%d", review.ID))
+	headers.Set("Location", fmt.Sprintf("/api/v1/reviews/%d", review.ID))
 	data := envelope{
 		"review": review,
 	}
@@ -56,8 +80,92 @@ func (a *appDependencies) createReviewHandler(w http.ResponseWriter, r *http.Req
 		a.serverErr(w, r, err)
 		return
 	}
+}
+
+/* Create or replace the current user's review of a book */
+func (a *appDependencies) upsertReviewHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Rating     float64         `json:"rating"`
+		SubRatings data.SubRatings `json:"sub_ratings"`
+		Desc       string          `json:"body_markdown"`
+		Spoiler    bool            `json:"spoiler"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		BookID:     bookID,
+		UserID:     a.ctxGetUser(r).ID,
+		Rating:     incomingData.Rating,
+		SubRatings: incomingData.SubRatings,
+		Desc:       incomingData.Desc,
+		Spoiler:    incomingData.Spoiler,
+	}
+	v := validator.New()
+	data.ValidateReview(v, a.screener, a.config.reviews.maxLength, review)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	_, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	created, err := a.reviewModel.Upsert(review)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	if created {
+		a.recordPost(review.UserID)
+	}
+	a.flagForModeration(v, "review", review.ID)
+
+	status := http.StatusOK
+	headers := make(http.Header)
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/api/v1/reviews/%d", review.ID))
+	}
+	data := envelope{
+		"review": review,
+	}
+
+	err = a.writeJSON(w, status, data, headers)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Tell the client where the review that blocked theirs can be found */
+func (a *appDependencies) duplicateReview(w http.ResponseWriter, r *http.Request, bookID int64, userID int64) {
+	existing, err := a.reviewModel.GetForBookUser(bookID, userID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
 
-	fmt.Fprintf(w, "%+v\n", incomingData)
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reviews/%d", existing.ID))
+	msg := "you have already reviewed this book, update your existing review instead"
+	a.errResponseJSON(w, r, http.StatusConflict, msg)
 }
 
 /* Display a review */
@@ -68,6 +176,13 @@ func (a *appDependencies) displayReviewHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	v := validator.New()
+	hideSpoilers := a.getOptionalBoolParameters(r.URL.Query(), "hide_spoilers", v)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
 	review, err := a.reviewModel.Get(id)
 	if err != nil {
 		switch {
@@ -79,6 +194,15 @@ func (a *appDependencies) displayReviewHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if review.Hidden && !a.canSeeHidden(r, review.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	if hideSpoilers != nil && *hideSpoilers {
+		review.HideSpoilers()
+	}
+
 	data := envelope{
 		"review": review,
 	}
@@ -90,7 +214,75 @@ func (a *appDependencies) displayReviewHandler(w http.ResponseWriter, r *http.Re
 	}
 }
 
-/* Update a review */
+/* List the reviews of a book */
+func (a *appDependencies) listBookReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var queryParametersData struct {
+		Rating       int
+		HasText      *bool
+		HideSpoilers *bool
+		data.Filters
+	}
+	queryParameters := r.URL.Query()
+	v := validator.New()
+	queryParametersData.Rating = a.getSingleIntegerParameters(queryParameters, "rating", 0, v)
+	queryParametersData.HasText = a.getOptionalBoolParameters(queryParameters, "has_text", v)
+	queryParametersData.HideSpoilers = a.getOptionalBoolParameters(queryParameters, "hide_spoilers", v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "helpful")
+	if sort, ok := data.ReviewSortAliases[queryParametersData.Filters.Sort]; ok {
+		queryParametersData.Filters.Sort = sort
+	}
+	queryParametersData.Filters.SortSafeList = data.ReviewSortSafeList
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+	// leaving the rating out (or 0) doesn't filter on it
+	v.Check(queryParametersData.Rating == 0 || (queryParametersData.Rating >= 1 && queryParametersData.Rating <= 5), "rating", "must be between 1 and 5")
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	_, err = a.bookModel.Get(bookID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	reviews, metadata, err := a.reviewModel.GetAll(bookID, int64(queryParametersData.Rating), queryParametersData.HasText, queryParametersData.Filters)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	if queryParametersData.HideSpoilers != nil && *queryParametersData.HideSpoilers {
+		for _, review := range reviews {
+			review.HideSpoilers()
+		}
+	}
+
+	data := envelope{
+		"reviews":   reviews,
+		"@metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Edit the rating and body of the current user's review */
 func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -109,12 +301,16 @@ func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if review.UserID != a.ctxGetUser(r).ID {
+		a.notPermitted(w, r)
+		return
+	}
+
 	var incomingData struct {
-		BookID    *int64     `json:"book_id"`
-		UserID    *int64     `json:"user_id"`
-		Rating    *int64     `json:"rating"`
-		Desc      *string    `json:"desc"`
-		CreatedAt *time.Time `json:"-"`
+		Rating     *float64         `json:"rating"`
+		SubRatings *data.SubRatings `json:"sub_ratings"`
+		Desc       *string          `json:"body_markdown"`
+		Spoiler    *bool            `json:"spoiler"`
 	}
 	err = a.readJSON(w, r, &incomingData)
 	if err != nil {
@@ -122,24 +318,21 @@ func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if incomingData.BookID != nil {
-		review.BookID = *incomingData.BookID
-	}
-	if incomingData.UserID != nil {
-		review.UserID = *incomingData.UserID
-	}
 	if incomingData.Rating != nil {
 		review.Rating = *incomingData.Rating
 	}
+	if incomingData.SubRatings != nil {
+		review.SubRatings = *incomingData.SubRatings
+	}
 	if incomingData.Desc != nil {
 		review.Desc = *incomingData.Desc
 	}
-	if incomingData.CreatedAt != nil {
-		review.CreatedAt = *incomingData.CreatedAt
+	if incomingData.Spoiler != nil {
+		review.Spoiler = *incomingData.Spoiler
 	}
 
 	v := validator.New()
-	data.ValidateReview(v, review)
+	data.ValidateReview(v, a.screener, a.config.reviews.maxLength, review)
 	if !v.IsEmpty() {
 		a.failedValidation(w, r, v.Errors)
 		return
@@ -147,10 +340,17 @@ func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Req
 
 	err = a.reviewModel.Update(review)
 	if err != nil {
-		a.serverErr(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
 		return
 	}
 
+	a.flagForModeration(v, "review", review.ID)
+
 	data := envelope{
 		"review": review,
 	}
@@ -162,7 +362,63 @@ func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Req
 	}
 }
 
-/* Delete a review */
+/* List the earlier versions of a review, newest first */
+func (a *appDependencies) reviewHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	v := validator.New()
+	hideSpoilers := a.getOptionalBoolParameters(r.URL.Query(), "hide_spoilers", v)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	review, err := a.reviewModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if review.Hidden && !a.canSeeHidden(r, review.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	revisions, err := a.reviewModel.GetRevisions(review.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	// earlier versions can give away as much as the current one, so they are redacted along with it
+	if hideSpoilers != nil && *hideSpoilers {
+		review.HideSpoilers()
+		for _, revision := range revisions {
+			revision.HideSpoilers()
+		}
+	}
+
+	data := envelope{
+		"review":    review,
+		"revisions": revisions,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Delete a review, only its author or a moderator can */
 func (a *appDependencies) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -170,7 +426,24 @@ func (a *appDependencies) deleteReviewHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = a.reviewModel.Delete(id)
+	review, err := a.reviewModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	if review.UserID != user.ID && !a.isModerator(user) {
+		a.notPermitted(w, r)
+		return
+	}
+
+	err = a.reviewModel.Delete(review.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -190,3 +463,102 @@ func (a *appDependencies) deleteReviewHandler(w http.ResponseWriter, r *http.Req
 		a.serverErr(w, r, err)
 	}
 }
+
+/* Mark a review as helpful or unhelpful, voting again changes the current user's vote */
+func (a *appDependencies) voteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Helpful *bool `json:"helpful"`
+	}
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	review, err := a.reviewModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	if review.Hidden && !a.canSeeHidden(r, review.UserID) {
+		a.notFound(w, r)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	v := validator.New()
+	v.Check(incomingData.Helpful != nil, "helpful", "must be provided")
+	v.Check(review.UserID != user.ID, "review", "you can't vote on your own review")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.reviewModel.Vote(review.ID, user.ID, *incomingData.Helpful)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	review, err = a.reviewModel.Get(review.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review": review,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Take back the current user's vote on a review */
+func (a *appDependencies) unvoteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	err = a.reviewModel.Unvote(id, a.ctxGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	review, err := a.reviewModel.Get(id)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review": review,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
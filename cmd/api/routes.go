@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/thats-insane/awt-final/internal/data"
 )
 
 func (a *appDependencies) routes() http.Handler {
@@ -14,34 +15,93 @@ func (a *appDependencies) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/api/v1/healthcheck", a.healthCheckHandler)
 
 	router.HandlerFunc(http.MethodGet, "/api/v1/books", a.requireActivated(a.listBooksHandler))
-	router.HandlerFunc(http.MethodGet, "/api/v1/books/search", a.requireActivated(a.searchBooksHandler))
-	// router.HandlerFunc(http.MethodGet, "/api/v1/books/:id", a.requireActivated(a.displayBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/:id", a.requireActivated(a.displayBookHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/books/:id/reviews", a.requireActivated(a.listBookReviewsHandler))
 
 	router.HandlerFunc(http.MethodGet, "/api/v1/lists", a.requireActivated(a.listListsHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/lists/:id", a.requireActivated(a.displayListHandler))
-	// router.HandlerFunc(http.MethodGet, "/api/v1/books/:id/reviews", a.requireActivated(a.displayReviewHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id", a.requireActivated(a.displayUserHandler))
 	// router.Handler(http.MethodGet, "/api/v1/users/:id/lists", a.requireActivated(a.displayUserListsHandler))
 	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id/reviews", a.requireActivated(a.displayUserReviewsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id/goals", a.requireActivated(a.listUserGoalsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id/followers", a.requireActivated(a.listFollowersHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id/following", a.requireActivated(a.listFollowingHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/users/:id/sessions", a.requireAuth(a.listSessionsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/feed", a.requireActivated(a.feedHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/goals/:id", a.requireActivated(a.displayGoalHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/challenges", a.requireActivated(a.listChallengesHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/challenges/:id", a.requireActivated(a.displayChallengeHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/challenges/:id/leaderboard", a.requireActivated(a.challengeLeaderboardHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:id", a.requireActivated(a.displayReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:id/comments", a.requireActivated(a.listReviewCommentsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/reviews/:id/history", a.requireActivated(a.reviewHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/comments/:id", a.requireActivated(a.displayCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/moderation/reports", a.requirePermission(data.PermissionReviewsModerate, a.listReportsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/moderation/reports/:id", a.requirePermission(data.PermissionReviewsModerate, a.displayReportHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/moderation/actions", a.requirePermission(data.PermissionReviewsModerate, a.listModerationActionsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/admin/users/:id/permissions", a.requirePermission(data.PermissionUsersAdmin, a.listUserPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/imports/:id", a.requireActivated(a.displayImportHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/exports/:id", a.requireActivated(a.displayExportHandler))
+	router.HandlerFunc(http.MethodGet, "/api/v1/exports/:id/download", a.downloadExportHandler)
 
 	router.HandlerFunc(http.MethodPost, "/api/v1/users", a.createUserHandler)
-	router.HandlerFunc(http.MethodPost, "/api/v1/books", a.requireActivated(a.createBookHandler))
-	router.HandlerFunc(http.MethodPost, "/api/v1/lists", a.requireActivated(a.createListHandler))
-	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/books", a.requireActivated(a.addBookToListHandler))
-	router.HandlerFunc(http.MethodPost, "/api/vi/books/:id/reviews", a.requireActivated(a.createReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/imports", a.requirePermission(data.PermissionReviewsWrite, a.createImportHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/export", a.requireAuth(a.createExportHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/email", a.requireActivated(a.requestEmailChangeHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/users/me/2fa", a.requireAuthForMFASetup(a.enrollMFAHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/follows/:id", a.requireActivated(a.followUserHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books", a.requirePermission(data.PermissionBooksWrite, a.createBookHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists", a.requirePermission(data.PermissionListsWrite, a.createListHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/books", a.requirePermission(data.PermissionListsWrite, a.addBookToListHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/lists/:id/fork", a.requirePermission(data.PermissionListsWrite, a.forkListHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books/:id/reviews", a.requirePermission(data.PermissionReviewsWrite, a.createReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reviews/:id/vote", a.requirePermission(data.PermissionReviewsWrite, a.voteReviewHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reviews/:id/comments", a.requirePermission(data.PermissionReviewsWrite, a.createCommentHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/books/:id/finished", a.requireActivated(a.finishBookHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/goals", a.requireActivated(a.createGoalHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/challenges", a.requireActivated(a.createChallengeHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/challenges/:id/participants", a.requireActivated(a.joinChallengeHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/reports", a.requireActivated(a.createReportHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/moderation/hide", a.requirePermission(data.PermissionReviewsModerate, a.hideContentHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/moderation/unhide", a.requirePermission(data.PermissionReviewsModerate, a.unhideContentHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/admin/users/:id/permissions", a.requirePermission(data.PermissionUsersAdmin, a.grantPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/activation", a.createActivationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/password-reset", a.createPasswordResetTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/authentication", a.createAuthTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/mfa", a.createMFAAuthTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/api/v1/tokens/refresh", a.refreshAuthTokenHandler)
 
 	router.HandlerFunc(http.MethodPut, "/api/v1/users/activated", a.activateUserHandler)
-	// router.HandlerFunc(http.MethodPut, "/api/v1/books/:id", a.requireActivated(a.updateBookHandler))
-	router.HandlerFunc(http.MethodPut, "/api/v1/lists/:id", a.requireActivated(a.updateListHandler))
-	router.HandlerFunc(http.MethodPut, "/api/v1/reviews/:id", a.requireActivated(a.updateReviewHandler))
+	// router.HandlerFunc(http.MethodPut, "/api/v1/books/:id", a.requirePermission(data.PermissionBooksWrite, a.updateBookHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/lists/:id", a.requirePermission(data.PermissionListsWrite, a.updateListHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/reviews/:id", a.requirePermission(data.PermissionReviewsWrite, a.updateReviewHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/books/:id/reviews/me", a.requirePermission(data.PermissionReviewsWrite, a.upsertReviewHandler))
 	router.HandlerFunc(http.MethodPut, "/api/v1/users/password", a.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/api/v1/users/email", a.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPut, "/api/v1/users/unlocked", a.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/api/v1/users/me/2fa", a.requireAuthForMFASetup(a.confirmMFAHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/comments/:id", a.requirePermission(data.PermissionReviewsWrite, a.updateCommentHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/moderation/reports/:id", a.requirePermission(data.PermissionReviewsModerate, a.resolveReportHandler))
+	router.HandlerFunc(http.MethodPut, "/api/v1/goals/:id", a.requireActivated(a.updateGoalHandler))
 
-	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:id", a.requireActivated(a.deleteBookHandler))
-	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id", a.requireActivated(a.deleteListHandler))
-	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id/books", a.requireActivated(a.deleteBookFromListHandler))
-	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:id", a.requireActivated(a.deleteReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/api/v1/users/me", a.requireActivated(a.updateCurrentUserHandler))
+
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me", a.requireAuth(a.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/2fa", a.requireAuth(a.disableMFAHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/sessions", a.requireAuth(a.revokeAllSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/users/me/sessions/:id", a.requireAuth(a.revokeSessionHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/tokens/authentication/current", a.requireAuthForMFASetup(a.logoutHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/follows/:id", a.requireActivated(a.unfollowUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:id", a.requirePermission(data.PermissionBooksWrite, a.deleteBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id", a.requirePermission(data.PermissionListsWrite, a.deleteListHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/lists/:id/books", a.requirePermission(data.PermissionListsWrite, a.deleteBookFromListHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:id", a.requirePermission(data.PermissionReviewsWrite, a.deleteReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/reviews/:id/vote", a.requirePermission(data.PermissionReviewsWrite, a.unvoteReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/comments/:id", a.requirePermission(data.PermissionReviewsWrite, a.deleteCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/books/:id/finished", a.requireActivated(a.unfinishBookHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/goals/:id", a.requireActivated(a.deleteGoalHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/admin/users/:id/permissions", a.requirePermission(data.PermissionUsersAdmin, a.revokePermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/api/v1/challenges/:id/participants", a.requireActivated(a.leaveChallengeHandler))
 
 	return a.recoverPanic(a.enableCORS(a.rateLimit(a.authenticate(router))))
 }
@@ -10,6 +10,8 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+
+	"github.com/thats-insane/awt-final/internal/data"
 )
 
 func (a *appDependencies) serve() error {
@@ -24,6 +26,32 @@ func (a *appDependencies) serve() error {
 
 	shutdownErr := make(chan error)
 
+	// SIGHUP reloads the text screening rules so they can be changed without a restart
+	if a.screener != nil {
+		go func() {
+			reload := make(chan os.Signal, 1)
+			signal.Notify(reload, syscall.SIGHUP)
+			for range reload {
+				err := a.screener.Reload()
+				if err != nil {
+					a.logger.Error(err.Error())
+					continue
+				}
+				a.logger.Info("reloaded text screening rules", "config", a.config.screening.config)
+			}
+		}()
+	}
+
+	// expired data is cleared out every hour, the first pass runs straight away
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			a.cleanup()
+			<-ticker.C
+		}
+	}()
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -59,3 +87,16 @@ func (a *appDependencies) serve() error {
 
 	return apiServer.ListenAndServe()
 }
+
+/* Throw away data that is no longer needed */
+func (a *appDependencies) cleanup() {
+	err := a.exportModel.DeleteExpired(data.ExportTTL)
+	if err != nil {
+		a.logger.Error(err.Error(), "cleanup", "exports")
+	}
+
+	err = a.tokenModel.DeleteExpired()
+	if err != nil {
+		a.logger.Error(err.Error(), "cleanup", "tokens")
+	}
+}
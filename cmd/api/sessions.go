@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/awt-final/internal/data"
+)
+
+/* Log out by revoking the token the request was made with */
+func (a *appDependencies) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.tokenModel.DeleteSessionForPlaintext(a.ctxGetToken(r))
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "you have been logged out",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* List the places the current user is logged in */
+func (a *appDependencies) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := a.tokenModel.GetSessions(a.ctxGetUser(r).ID, a.ctxGetToken(r))
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"sessions": sessions,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Revoke one of the current user's sessions, such as a device they no longer use */
+func (a *appDependencies) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFound(w, r)
+		return
+	}
+
+	err = a.tokenModel.DeleteSession(a.ctxGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "session revoked",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Log the current user out everywhere, including the session making the request */
+func (a *appDependencies) revokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.tokenModel.DeleteAllSessionsForUser(a.ctxGetUser(r).ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "you have been logged out everywhere",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"errors"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/thats-insane/awt-final/internal/data"
@@ -29,10 +32,22 @@ func (a *appDependencies) createAuthTokenHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	ok := a.checkLoginFailures(w, r, data.LoginScopeIP, ip)
+	if !ok {
+		return
+	}
+
 	user, err := a.userModel.GetByEmail(incomingData.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			a.recordLoginFailure(ip, nil)
 			a.invalidCredentials(w, r)
 		default:
 			a.serverErr(w, r, err)
@@ -40,6 +55,11 @@ func (a *appDependencies) createAuthTokenHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	ok = a.checkLoginFailures(w, r, data.LoginScopeAccount, strconv.FormatInt(user.ID, 10))
+	if !ok {
+		return
+	}
+
 	match, err := user.Password.Matches(incomingData.Password)
 	if err != nil {
 		a.serverErr(w, r, err)
@@ -47,18 +67,190 @@ func (a *appDependencies) createAuthTokenHandler(w http.ResponseWriter, r *http.
 	}
 
 	if !match {
+		a.recordLoginFailure(ip, user)
+		a.invalidCredentials(w, r)
+		return
+	}
+
+	mfa, err := a.mfaModel.Get(user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	// with two-factor authentication on, failed logins are only reset once the code has been checked too
+	if mfa.Enabled {
+		token, err := a.tokenModel.New(user.ID, 5*time.Minute, data.ScopeMFAPending)
+		if err != nil {
+			a.serverErr(w, r, err)
+			return
+		}
+
+		data := envelope{
+			"mfaRequired": true,
+			"mfaToken":    token,
+		}
+
+		err = a.writeJSON(w, http.StatusOK, data, nil)
+		if err != nil {
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	a.issueAuthToken(w, r, user)
+}
+
+/* Finish logging in to an account with two-factor authentication, swapping the mfa-pending token and a code (or a recovery code) for an authentication token */
+func (a *appDependencies) createMFAAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Token        string `json:"token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.Token)
+	v.Check((incomingData.Code == "") != (incomingData.RecoveryCode == ""), "code", "must provide either a code or a recovery code")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	ok := a.checkLoginFailures(w, r, data.LoginScopeIP, ip)
+	if !ok {
+		return
+	}
+
+	user, err := a.userModel.GetForToken(data.ScopeMFAPending, incomingData.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired token")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	ok = a.checkLoginFailures(w, r, data.LoginScopeAccount, strconv.FormatInt(user.ID, 10))
+	if !ok {
+		return
+	}
+
+	match, err := a.checkSecondFactor(user, incomingData.Code, incomingData.RecoveryCode)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	if !match {
+		a.recordLoginFailure(ip, user)
 		a.invalidCredentials(w, r)
 		return
 	}
 
-	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = a.tokenModel.DeleteAllForUser(data.ScopeMFAPending, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.issueAuthToken(w, r, user)
+}
+
+/* Clear the failed logins of a user who got all the way through logging in, and give them an authentication token */
+func (a *appDependencies) issueAuthToken(w http.ResponseWriter, r *http.Request, user *data.User) {
+	err := a.loginModel.Reset(data.LoginScopeAccount, strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	err = a.loginModel.Decay(data.LoginScopeIP, ip)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	access, refresh, err := a.tokenModel.NewSession(user.ID, a.config.tokens.accessTTL, a.config.tokens.refreshTTL, r.UserAgent(), ip)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"authenticationToken": access,
+		"refreshToken":        refresh,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Swap a refresh token for a new access token and refresh token, the old refresh token stops working and the session still ends when it first would have */
+func (a *appDependencies) refreshAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.RefreshToken)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		a.serverErr(w, r, err)
 		return
 	}
 
+	access, refresh, err := a.tokenModel.Rotate(incomingData.RefreshToken, a.config.tokens.accessTTL, r.UserAgent(), ip)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidRefreshToken(w, r)
+		case errors.Is(err, data.ErrTokenReused):
+			a.logger.Warn("refresh token reused, session revoked", "ip", ip)
+			a.invalidRefreshToken(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
 	data := envelope{
-		"authenticationToken": token,
+		"authenticationToken": access,
+		"refreshToken":        refresh,
 	}
 
 	err = a.writeJSON(w, http.StatusCreated, data, nil)
@@ -110,3 +302,142 @@ func (a *appDependencies) createPasswordResetTokenHandler(w http.ResponseWriter,
 		return
 	}
 }
+
+/* Send a new activation token to a user whose welcome email went missing, any earlier activation tokens stop working */
+func (a *appDependencies) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	// every address gets the same answer, whether or not it has an account waiting to be activated, so
+	// neither the answer nor the limit can be used to find accounts
+	message := envelope{
+		"message": "if that email address belongs to an account that isn't activated yet, an email will be sent to it containing activation instructions",
+	}
+
+	// this limit is always on, the request rate limiter can be turned off without letting anyone flood an inbox
+	if !a.activationLimiter.Allow(strings.ToLower(incomingData.Email)) {
+		a.rateLimitExceed(w, r)
+		return
+	}
+
+	user, err := a.userModel.GetByEmail(incomingData.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	if err != nil || user.Activated {
+		err = a.writeJSON(w, http.StatusAccepted, message, nil)
+		if err != nil {
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	err = a.tokenModel.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	token, err := a.tokenModel.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+		err := a.mailer.Send(user.Email, "token_activation.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	err = a.writeJSON(w, http.StatusAccepted, message, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Check whether logins from an account or IP are held back by earlier failures, writing the error response if they are */
+func (a *appDependencies) checkLoginFailures(w http.ResponseWriter, r *http.Request, scope string, key string) bool {
+	failures, err := a.loginModel.Get(scope, key)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return true
+		default:
+			a.serverErr(w, r, err)
+			return false
+		}
+	}
+
+	maxFailures := a.config.login.maxFailures
+	if scope == data.LoginScopeIP {
+		maxFailures = a.config.login.ipMaxFailures
+	}
+
+	wait := failures.Wait(maxFailures, a.config.login.lockout)
+	if wait > 0 {
+		a.loginThrottled(w, r, wait)
+		return false
+	}
+	return true
+}
+
+/* Count a failed login against the client IP, and against the account when the email matched one. Locking an account emails its owner an unlock token */
+func (a *appDependencies) recordLoginFailure(ip string, user *data.User) {
+	_, _, err := a.loginModel.RecordFailure(data.LoginScopeIP, ip, a.config.login.ipMaxFailures, a.config.login.lockout)
+	if err != nil {
+		a.logger.Error(err.Error(), "ip", ip)
+	}
+	if user == nil {
+		return
+	}
+
+	failures, locked, err := a.loginModel.RecordFailure(data.LoginScopeAccount, strconv.FormatInt(user.ID, 10), a.config.login.maxFailures, a.config.login.lockout)
+	if err != nil {
+		a.logger.Error(err.Error(), "user_id", user.ID)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeUnlock)
+	if err != nil {
+		a.logger.Error(err.Error(), "user_id", user.ID)
+		return
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"username":    user.Username,
+			"failures":    failures.Failures,
+			"lockedUntil": failures.LockedUntil.Format(time.RFC1123),
+			"unlockToken": token.Plaintext,
+		}
+		err := a.mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/thats-insane/awt-final/internal/data"
@@ -42,7 +44,7 @@ func (a *appDependencies) createUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = a.userModel.Insert(user)
+	err = a.userModel.Insert(user, data.DefaultPermissions...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -125,6 +127,12 @@ func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	err = a.tokenModel.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
 	data := envelope{
 		"user": user,
 	}
@@ -135,9 +143,9 @@ func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Req
 	}
 }
 
-/* Grab user from database and display */
+/* Display a user's public profile, or everything about the current user when they ask for "me" or their own ID */
 func (a *appDependencies) displayUserHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := a.readIDParam(r)
+	id, err := a.readUserIDParam(r)
 	if err != nil {
 		a.notFound(w, r)
 		return
@@ -154,8 +162,16 @@ func (a *appDependencies) displayUserHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if user.Hidden && !a.canSeeHidden(r, user.ID) {
+		a.notFound(w, r)
+		return
+	}
+
 	data := envelope{
-		"user": user,
+		"user": user.Public(),
+	}
+	if user.ID == a.ctxGetUser(r).ID {
+		data["user"] = user
 	}
 
 	err = a.writeJSON(w, http.StatusOK, data, nil)
@@ -208,7 +224,7 @@ func (a *appDependencies) displayUserListsHandler(w http.ResponseWriter, r *http
 
 /* Display users and reviews they have made */
 func (a *appDependencies) displayUserReviewsHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := a.readIDParam(r)
+	id, err := a.readUserIDParam(r)
 	if err != nil {
 		a.notFound(w, r)
 		return
@@ -226,7 +242,7 @@ func (a *appDependencies) displayUserReviewsHandler(w http.ResponseWriter, r *ht
 	}
 
 	// iterate over all the user reviews and match them to the book
-	var data map[string]any
+	data := envelope{}
 	for i, review := range userreviews {
 		reviews := envelope{
 			"bookID": review.BookID,
@@ -241,6 +257,140 @@ func (a *appDependencies) displayUserReviewsHandler(w http.ResponseWriter, r *ht
 	}
 }
 
+/* Update the current user's username and profile */
+func (a *appDependencies) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.ctxGetUser(r)
+
+	var incomingData struct {
+		Username        *string   `json:"username"`
+		DisplayName     *string   `json:"display_name"`
+		Bio             *string   `json:"bio"`
+		AvatarURL       *string   `json:"avatar_url"`
+		Location        *string   `json:"location"`
+		FavouriteGenres *[]string `json:"favourite_genres"`
+		Website         *string   `json:"website"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	if incomingData.Username != nil {
+		user.Username = *incomingData.Username
+	}
+	if incomingData.DisplayName != nil {
+		user.DisplayName = *incomingData.DisplayName
+	}
+	if incomingData.Bio != nil {
+		user.Bio = *incomingData.Bio
+	}
+	if incomingData.AvatarURL != nil {
+		user.AvatarURL = *incomingData.AvatarURL
+	}
+	if incomingData.Location != nil {
+		user.Location = *incomingData.Location
+	}
+	if incomingData.FavouriteGenres != nil {
+		user.FavouriteGenres = *incomingData.FavouriteGenres
+	}
+	if incomingData.Website != nil {
+		user.Website = *incomingData.Website
+	}
+
+	v := validator.New()
+	data.ValidateUser(v, user)
+	data.ValidateProfile(v, a.screener, &user.Profile)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflict(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	a.flagForModeration(v, "user", user.ID)
+
+	data := envelope{
+		"user": user,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Delete the current user's account once they have confirmed their password */
+func (a *appDependencies) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password string `json:"password"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentials(w, r)
+		return
+	}
+
+	policy := a.config.accounts.deletionPolicy
+	err = a.userModel.Delete(user.ID, policy)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFound(w, r)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"username":   user.Username,
+			"anonymized": policy == data.DeletionAnonymize,
+		}
+		err := a.mailer.Send(user.Email, "account_deleted.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	data := envelope{
+		"message": "your account has been deleted",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
 func (a *appDependencies) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	var incomingData struct {
 		Password string `json:"password"`
@@ -306,6 +456,13 @@ func (a *appDependencies) updateUserPasswordHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// whoever knew the old password may still be logged in
+	err = a.tokenModel.DeleteAllSessionsForUser(user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
 	data := envelope{
 		"message": "password successfully reset",
 	}
@@ -316,3 +473,210 @@ func (a *appDependencies) updateUserPasswordHandler(w http.ResponseWriter, r *ht
 		return
 	}
 }
+
+/* Start changing the current user's email, the new address only takes over once the token sent to it is confirmed */
+func (a *appDependencies) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	user := a.ctxGetUser(r)
+	v := validator.New()
+	data.ValidateEmail(v, incomingData.Email)
+	v.Check(!strings.EqualFold(incomingData.Email, user.Email), "email", "must be different from your current email")
+	v.Check(incomingData.Password != "", "password", "must be provided")
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+	if !match {
+		a.invalidCredentials(w, r)
+		return
+	}
+
+	_, err = a.userModel.GetByEmail(incomingData.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email already exists")
+		a.failedValidation(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		a.serverErr(w, r, err)
+		return
+	}
+
+	err = a.userModel.SetPendingEmail(user.ID, incomingData.Email)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	// only the latest request can be confirmed
+	err = a.tokenModel.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"username":   user.Username,
+			"newEmail":   incomingData.Email,
+			"emailToken": token.Plaintext,
+		}
+		err := a.mailer.Send(incomingData.Email, "email_change.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+
+		// the old address is only told about the change, it never gets the token
+		notice := map[string]any{
+			"username": user.Username,
+			"newEmail": incomingData.Email,
+		}
+		err = a.mailer.Send(user.Email, "email_change_notice.tmpl", notice)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	data := envelope{
+		"message": "a confirmation token has been sent to your new email address",
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Confirm an email change with the token sent to the new address */
+func (a *appDependencies) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Token string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.Token)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetForToken(data.ScopeEmailChange, incomingData.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired token")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	err = a.userModel.ConfirmPendingEmail(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists")
+			a.failedValidation(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired token")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	err = a.tokenModel.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"user": user,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
+
+/* Lift a login lockout early with the token from the lockout email */
+func (a *appDependencies) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Token string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.Token)
+	if !v.IsEmpty() {
+		a.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetForToken(data.ScopeUnlock, incomingData.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired token")
+			a.failedValidation(w, r, v.Errors)
+		default:
+			a.serverErr(w, r, err)
+		}
+		return
+	}
+
+	err = a.loginModel.Reset(data.LoginScopeAccount, strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	err = a.tokenModel.DeleteAllForUser(data.ScopeUnlock, user.ID)
+	if err != nil {
+		a.serverErr(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "your account has been unlocked",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErr(w, r, err)
+	}
+}
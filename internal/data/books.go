@@ -3,6 +3,8 @@ package data
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -11,16 +13,33 @@ import (
 )
 
 type Book struct {
-	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Author    string    `json:"author"`
-	ISBN      string    `json:"isbn"`
-	PubDate   time.Time `json:"pub_date"`
-	Genre     string    `json:"genre"`
-	Desc      string    `json:"description"`
-	AvgRating float64   `json:"avg_rating"`
+	ID        int64          `json:"id"`
+	Title     string         `json:"title"`
+	Author    string         `json:"author"`
+	ISBN      string         `json:"isbn"`
+	PubDate   time.Time      `json:"pub_date"`
+	Genre     string         `json:"genre"`
+	Desc      string         `json:"description"`
+	AvgRating float64        `json:"avg_rating"`
+	Ratings   *RatingSummary `json:"ratings,omitempty"`
 }
 
+/* A saved book search, used to fill smart lists when they are read */
+type BookQuery struct {
+	Title           string     `json:"title,omitempty"`
+	Author          string     `json:"author,omitempty"`
+	Genre           string     `json:"genre,omitempty"`
+	MinRating       *float64   `json:"min_rating,omitempty"`
+	PublishedAfter  *time.Time `json:"published_after,omitempty"`
+	PublishedBefore *time.Time `json:"published_before,omitempty"`
+	Finished        *bool      `json:"finished,omitempty"`
+	Shelf           string     `json:"shelf,omitempty"`
+	Sort            string     `json:"sort,omitempty"`
+}
+
+/* Sort values accepted by book listings and smart list queries */
+var BookSortSafeList = []string{"id", "title", "author", "genre", "publication_date", "average_rating", "-id", "-title", "-author", "-genre", "-publication_date", "-average_rating"}
+
 type BookModel struct {
 	DB *sql.DB
 }
@@ -57,7 +76,7 @@ func (b BookModel) Get(id int64) (*Book, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := b.DB.QueryRowContext(ctx, query, id).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Author, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
+	err := b.DB.QueryRowContext(ctx, query, id).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -69,19 +88,74 @@ func (b BookModel) Get(id int64) (*Book, error) {
 	return &book, nil
 }
 
-/* Select all books */
-func (b BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
-	query := fmt.Sprintf(`
+/* Select a book using its ISBN */
+func (b BookModel) GetByISBN(isbn string) (*Book, error) {
+	query := `
+		SELECT id, title, author, isbn, publication_date, genre, description, average_rating
+		FROM books
+		WHERE isbn = $1
+	`
+
+	var book Book
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := b.DB.QueryRowContext(ctx, query, isbn).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &book, nil
+}
+
+/* Select a book using its exact title and author, ignoring case */
+func (b BookModel) GetByTitleAuthor(title string, author string) (*Book, error) {
+	query := `
 		SELECT id, title, author, isbn, publication_date, genre, description, average_rating
 		FROM books
+		WHERE LOWER(title) = LOWER($1) AND LOWER(author) = LOWER($2)
+		ORDER BY id
+		LIMIT 1
+	`
+
+	var book Book
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := b.DB.QueryRowContext(ctx, query, title, author).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &book, nil
+}
+
+/* Select all books, narrowed down by title, author and genre when they are given */
+func (b BookModel) GetAll(title string, author string, genre string, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, title, author, isbn, publication_date, genre, description, average_rating
+		FROM books
+		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (to_tsvector('simple', author) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (to_tsvector('simple', genre) @@ plainto_tsquery('simple', $3) OR $3 = '')
 		ORDER BY %s %s, id ASC
-		LIMIT $1 OFFSET $2
-		`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $4 OFFSET $5
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{title, author, genre, filters.limit(), filters.offset()}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := b.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	rows, err := b.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -92,7 +166,7 @@ func (b BookModel) GetAll(filters Filters) ([]*Book, Metadata, error) {
 
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
+		err := rows.Scan(&totalRecords, &book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -155,25 +229,37 @@ func (b BookModel) Delete(id int64) error {
 	return nil
 }
 
-/* Select a book using filters */
-func (b BookModel) Search(title string, author string, genre string, filters Filters) ([]*Book, Metadata, error) {
-	query := `
-        SELECT id, title, author, isbn, publication_date, genre, description, average_rating
+/* Select the books matching a saved query, where finished and shelf are relative to the owner of the query and min_rating is against the average of the book's visible reviews */
+func (b BookModel) Query(q *BookQuery, ownerID int64, filters Filters) ([]*Book, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, title, author, isbn, publication_date, genre, description, average_rating
 		FROM books
-        WHERE (to_tsvector('simple', title) @@
-              plainto_tsquery('simple', $1) OR $1 = '')
-        AND (to_tsvector('simple', author) @@
-             plainto_tsquery('simple', $2) OR $2 = '')
-		AND (to_tsvector('simple', genre) @@
-             plainto_tsquery('simple', $3) OR $3 = '')
-        ORDER BY id
-		LIMIT $4 OFFSET $5
-     `
+		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (to_tsvector('simple', author) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND (LOWER(genre) = LOWER($3) OR $3 = '')
+		AND ($4::numeric IS NULL OR (
+			SELECT COALESCE(ROUND(AVG(rating), 2), 0) FROM reviews
+			WHERE reviews.book_id = books.id AND NOT reviews.hidden) >= $4::numeric)
+		AND (publication_date > $5::date OR $5::date IS NULL)
+		AND (publication_date < $6::date OR $6::date IS NULL)
+		AND ($7::bool IS NULL OR $7::bool = EXISTS (
+			SELECT 1 FROM finished_books
+			WHERE finished_books.book_id = books.id AND finished_books.user_id = $8))
+		AND ($9 = '' OR EXISTS (
+			SELECT 1 FROM book_list
+			INNER JOIN lists ON lists.id = book_list.list_id
+			WHERE book_list.book_id = books.id AND lists.user_id = $8
+			AND lists.kind = 'manual' AND LOWER(lists.name) = LOWER($9)))
+		ORDER BY %s %s, id ASC
+		LIMIT $10 OFFSET $11
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{q.Title, q.Author, q.Genre, q.MinRating, q.PublishedAfter, q.PublishedBefore, q.Finished, ownerID, q.Shelf, filters.limit(), filters.offset()}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := b.DB.QueryContext(ctx, query, title, author, genre)
+	rows, err := b.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -184,7 +270,7 @@ func (b BookModel) Search(title string, author string, genre string, filters Fil
 
 	for rows.Next() {
 		var book Book
-		err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
+		err := rows.Scan(&totalRecords, &book.ID, &book.Title, &book.Author, &book.ISBN, &book.PubDate, &book.Genre, &book.Desc, &book.AvgRating)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -201,6 +287,44 @@ func (b BookModel) Search(title string, author string, genre string, filters Fil
 	return books, metadata, nil
 }
 
+/* Store a book query as JSON (as a string, since pq would send bytes as bytea) */
+func (q BookQuery) Value() (driver.Value, error) {
+	js, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	return string(js), nil
+}
+
+/* Read a book query back from JSON */
+func (q *BookQuery) Scan(src any) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, q)
+	case string:
+		return json.Unmarshal([]byte(src), q)
+	default:
+		return fmt.Errorf("cannot scan %T into a book query", src)
+	}
+}
+
+/* Validation for a saved book query */
+func ValidateBookQuery(v *validator.Validator, q *BookQuery) {
+	v.Check(len(q.Title) <= 100, "query.title", "must not be more than 100 bytes long")
+	v.Check(len(q.Author) <= 100, "query.author", "must not be more than 100 bytes long")
+	v.Check(len(q.Genre) <= 50, "query.genre", "must not be more than 50 bytes long")
+	v.Check(len(q.Shelf) <= 100, "query.shelf", "must not be more than 100 bytes long")
+	if q.MinRating != nil {
+		v.Check(*q.MinRating >= 0 && *q.MinRating <= 5, "query.min_rating", "must be between 0 and 5")
+	}
+	if q.PublishedAfter != nil && q.PublishedBefore != nil {
+		v.Check(q.PublishedAfter.Before(*q.PublishedBefore), "query.published_before", "must be after published_after")
+	}
+	if q.Sort != "" {
+		v.Check(validator.PermittedValue(q.Sort, BookSortSafeList...), "query.sort", "invalid sort value")
+	}
+}
+
 /* Validation for book */
 func ValidateBook(v *validator.Validator, book *Book) {
 	v.Check(book.Title != "", "book", "must be provided")
@@ -0,0 +1,240 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+type Challenge struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Desc         string    `json:"description"`
+	Genre        string    `json:"genre,omitempty"`
+	Target       int       `json:"target"`
+	StartsAt     time.Time `json:"starts_at"`
+	EndsAt       time.Time `json:"ends_at"`
+	CreatedBy    int64     `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	Participants int       `json:"participants"`
+}
+
+type Standing struct {
+	Rank     int          `json:"rank"`
+	UserID   int64        `json:"user_id"`
+	Username string       `json:"username"`
+	Progress GoalProgress `json:"progress"`
+}
+
+type ChallengeModel struct {
+	DB *sql.DB
+}
+
+/* Add a new challenge */
+func (c ChallengeModel) Insert(challenge *Challenge) error {
+	query := `
+		INSERT INTO challenges (name, description, genre, target, starts_at, ends_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	args := []any{challenge.Name, challenge.Desc, challenge.Genre, challenge.Target, challenge.StartsAt, challenge.EndsAt, challenge.CreatedBy}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return c.DB.QueryRowContext(ctx, query, args...).Scan(&challenge.ID, &challenge.CreatedAt)
+}
+
+/* Select a challenge */
+func (c ChallengeModel) Get(id int64) (*Challenge, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, description, genre, target, starts_at, ends_at, COALESCE(created_by, 0), created_at,
+			(SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = challenges.id)
+		FROM challenges
+		WHERE id = $1
+	`
+
+	var challenge Challenge
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(&challenge.ID, &challenge.Name, &challenge.Desc, &challenge.Genre, &challenge.Target, &challenge.StartsAt, &challenge.EndsAt, &challenge.CreatedBy, &challenge.CreatedAt, &challenge.Participants)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &challenge, nil
+}
+
+/* Select all challenges */
+func (c ChallengeModel) GetAll(filters Filters) ([]*Challenge, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, name, description, genre, target, starts_at, ends_at, COALESCE(created_by, 0), created_at,
+			(SELECT COUNT(*) FROM challenge_participants WHERE challenge_id = challenges.id)
+		FROM challenges
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	challenges := []*Challenge{}
+
+	for rows.Next() {
+		var challenge Challenge
+		err := rows.Scan(&totalRecords, &challenge.ID, &challenge.Name, &challenge.Desc, &challenge.Genre, &challenge.Target, &challenge.StartsAt, &challenge.EndsAt, &challenge.CreatedBy, &challenge.CreatedAt, &challenge.Participants)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		challenges = append(challenges, &challenge)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return challenges, metadata, nil
+}
+
+/* Add a user to a challenge (joining twice is a no-op) */
+func (c ChallengeModel) Join(challengeID int64, userID int64) error {
+	query := `
+		INSERT INTO challenge_participants (challenge_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, query, challengeID, userID)
+	return err
+}
+
+/* Remove a user from a challenge */
+func (c ChallengeModel) Leave(challengeID int64, userID int64) error {
+	query := `
+		DELETE FROM challenge_participants
+		WHERE challenge_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, challengeID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+/* Rank the participants of a challenge by the books they finished during it */
+func (c ChallengeModel) Leaderboard(challenge *Challenge, filters Filters) ([]*Standing, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), RANK() OVER (ORDER BY COUNT(finished_books.id) DESC), users.id, users.username, COUNT(finished_books.id)
+		FROM challenge_participants
+		INNER JOIN users ON users.id = challenge_participants.user_id
+		LEFT JOIN (finished_books INNER JOIN books ON books.id = finished_books.book_id)
+		ON finished_books.user_id = challenge_participants.user_id
+		AND finished_books.finished_at >= $2
+		AND finished_books.finished_at < $3
+		AND ($4 = '' OR LOWER(books.genre) = LOWER($4))
+		WHERE challenge_participants.challenge_id = $1
+		GROUP BY users.id, users.username
+		ORDER BY COUNT(finished_books.id) DESC, MIN(challenge_participants.joined_at) ASC, users.id ASC
+		LIMIT $5 OFFSET $6
+	`
+
+	start, end := challenge.period()
+	args := []any{challenge.ID, start, end, challenge.Genre, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var totalRecords int
+	standings := []*Standing{}
+
+	for rows.Next() {
+		var standing Standing
+		var finished int
+		err := rows.Scan(&totalRecords, &standing.Rank, &standing.UserID, &standing.Username, &finished)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		standing.Progress = calculateProgress(challenge.Target, finished, start, end, now)
+		standings = append(standings, &standing)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return standings, metadata, nil
+}
+
+/* A challenge runs from the start of its first day to the end of its last day */
+func (challenge *Challenge) period() (time.Time, time.Time) {
+	return challenge.StartsAt, challenge.EndsAt.AddDate(0, 0, 1)
+}
+
+/* Check whether the last day of the challenge is over */
+func (challenge *Challenge) HasEnded(now time.Time) bool {
+	_, end := challenge.period()
+	return !now.Before(end)
+}
+
+/* Validation for challenge */
+func ValidateChallenge(v *validator.Validator, challenge *Challenge) {
+	v.Check(challenge.Name != "", "name", "must be provided")
+	v.Check(len(challenge.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(challenge.Desc != "", "description", "must be provided")
+	v.Check(len(challenge.Desc) <= 225, "description", "must not be more than 225 bytes long")
+	v.Check(len(challenge.Genre) <= 50, "genre", "must not be more than 50 bytes long")
+	v.Check(challenge.Target > 0, "target", "must be a positive integer")
+	v.Check(challenge.Target <= 10000, "target", "must not be more than 10000")
+	v.Check(!challenge.StartsAt.IsZero(), "starts_at", "must be provided")
+	v.Check(!challenge.EndsAt.IsZero(), "ends_at", "must be provided")
+	v.Check(!challenge.EndsAt.Before(challenge.StartsAt), "ends_at", "must not be before starts_at")
+}
@@ -0,0 +1,224 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-final/internal/screening"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+type Comment struct {
+	ID        int64      `json:"id"`
+	ReviewID  int64      `json:"review_id"`
+	UserID    int64      `json:"user_id"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	Version   int        `json:"-"`
+	Hidden    bool       `json:"hidden,omitempty"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+/* Add a new comment, or a reply when it has a parent */
+func (c CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO review_comments (review_id, user_id, parent_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version
+	`
+
+	args := []any{comment.ReviewID, comment.UserID, comment.ParentID, comment.Body}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return c.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+}
+
+/* Select a comment */
+func (c CommentModel) Get(id int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, review_id, user_id, parent_id, body, created_at, version, hidden
+		FROM review_comments
+		WHERE id = $1
+	`
+
+	var comment Comment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(&comment.ID, &comment.ReviewID, &comment.UserID, &comment.ParentID, &comment.Body, &comment.CreatedAt, &comment.Version, &comment.Hidden)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &comment, nil
+}
+
+/* Select a page of a review's top level comments, each with all of its replies nested beneath it (a hidden comment takes its replies with it) */
+func (c CommentModel) GetAllForReview(reviewID int64, filters Filters) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, review_id, user_id, parent_id, body, created_at, version
+		FROM review_comments
+		WHERE review_id = $1 AND parent_id IS NULL AND NOT hidden
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, reviewID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	comments := []*Comment{}
+	threads := make(map[int64]*Comment)
+	ids := []int64{}
+
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(&totalRecords, &comment.ID, &comment.ReviewID, &comment.UserID, &comment.ParentID, &comment.Body, &comment.CreatedAt, &comment.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		comments = append(comments, &comment)
+		threads[comment.ID] = &comment
+		ids = append(ids, comment.ID)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	if len(ids) == 0 {
+		return comments, metadata, nil
+	}
+
+	// replies come back oldest first, so every parent is seen before its replies
+	query = `
+		WITH RECURSIVE thread AS (
+			SELECT id, review_id, user_id, parent_id, body, created_at, version
+			FROM review_comments
+			WHERE parent_id = ANY($1) AND NOT hidden
+			UNION ALL
+			SELECT rc.id, rc.review_id, rc.user_id, rc.parent_id, rc.body, rc.created_at, rc.version
+			FROM review_comments rc
+			INNER JOIN thread ON rc.parent_id = thread.id
+			WHERE NOT rc.hidden
+		)
+		SELECT id, review_id, user_id, parent_id, body, created_at, version
+		FROM thread
+		ORDER BY created_at ASC, id ASC
+	`
+
+	replies, err := c.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer replies.Close()
+
+	for replies.Next() {
+		var reply Comment
+		err := replies.Scan(&reply.ID, &reply.ReviewID, &reply.UserID, &reply.ParentID, &reply.Body, &reply.CreatedAt, &reply.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		threads[reply.ID] = &reply
+		if parent, ok := threads[*reply.ParentID]; ok {
+			parent.Replies = append(parent.Replies, &reply)
+		}
+	}
+
+	err = replies.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return comments, metadata, nil
+}
+
+/* Update a comment */
+func (c CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE review_comments
+		SET body = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version
+	`
+
+	args := []any{comment.Body, comment.ID, comment.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+/* Delete a comment along with all of its replies */
+func (c CommentModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM review_comments
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+/* Validation for a comment */
+func ValidateComment(v *validator.Validator, screener *screening.Screener, comment *Comment) {
+	v.Check(comment.ReviewID > 0, "review_id", "must be a positive integer")
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 2000, "body", "must not be more than 2000 bytes long")
+
+	screenText(v, screener, poster(comment.ID, comment.UserID), screening.Field{Name: "body", Text: comment.Body})
+}
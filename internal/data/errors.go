@@ -5,3 +5,8 @@ import "errors"
 var ErrRecordNotFound = errors.New("record not found")
 var ErrDuplicateEmail = errors.New("duplicate email")
 var ErrEditConflict = errors.New("edit conflict")
+var ErrDuplicateGoal = errors.New("duplicate goal")
+var ErrDuplicateReview = errors.New("duplicate review")
+var ErrDuplicateReport = errors.New("duplicate report")
+var ErrDuplicateFollow = errors.New("duplicate follow")
+var ErrTokenReused = errors.New("token reused")
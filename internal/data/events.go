@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+/* The kinds of activity that show up in the feed */
+const (
+	EventReviewCreated   = "review_created"
+	EventBookFinished    = "book_finished"
+	EventListCreated     = "list_created"
+	EventListBookAdded   = "list_book_added"
+	EventLibraryImported = "library_imported"
+)
+
+/* Something a user did, recorded by the model that did it so followers can see it in their feed */
+type Event struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Kind      string    `json:"kind"`
+	BookID    *int64    `json:"book_id,omitempty"`
+	ReviewID  *int64    `json:"review_id,omitempty"`
+	ListID    *int64    `json:"list_id,omitempty"`
+	Count     *int      `json:"count,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type EventModel struct {
+	DB *sql.DB
+}
+
+/* Select the activity of the users someone follows, newest first. Hidden users, reviews and lists are left out */
+func (e EventModel) GetFeed(userID int64, filters Filters) ([]*Event, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), events.id, events.user_id, users.username, events.kind, events.book_id, events.review_id, events.list_id, events.count, events.created_at
+		FROM events
+		INNER JOIN follows ON follows.followee_id = events.user_id AND follows.follower_id = $1
+		INNER JOIN users ON users.id = events.user_id
+		LEFT JOIN reviews ON reviews.id = events.review_id
+		LEFT JOIN lists ON lists.id = events.list_id
+		WHERE NOT users.hidden AND NOT COALESCE(reviews.hidden, false) AND NOT COALESCE(lists.hidden, false)
+		ORDER BY events.created_at DESC, events.id DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	events := []*Event{}
+
+	for rows.Next() {
+		var event Event
+		err := rows.Scan(&totalRecords, &event.ID, &event.UserID, &event.Username, &event.Kind, &event.BookID, &event.ReviewID, &event.ListID, &event.Count, &event.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		events = append(events, &event)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return events, metadata, nil
+}
+
+/* Record an event as part of the change it describes. Zero IDs are stored as NULL, and content nobody owns isn't recorded */
+func insertEvent(ctx context.Context, tx *sql.Tx, userID int64, kind string, bookID int64, reviewID int64, listID int64) error {
+	return insertEventAt(ctx, tx, time.Now(), userID, kind, bookID, reviewID, listID)
+}
+
+/* Record an event that happened at some other time, such as a book finished before it was logged */
+func insertEventAt(ctx context.Context, tx *sql.Tx, at time.Time, userID int64, kind string, bookID int64, reviewID int64, listID int64) error {
+	if userID < 1 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO events (user_id, kind, book_id, review_id, list_id, created_at)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), NULLIF($5, 0), $6)
+	`
+
+	_, err := tx.ExecContext(ctx, query, userID, kind, bookID, reviewID, listID, at)
+	return err
+}
+
+/* Record a finished library import as a single event, in place of the events its books would have made */
+func (e EventModel) InsertImport(userID int64, count int) error {
+	if userID < 1 || count < 1 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO events (user_id, kind, count)
+		VALUES ($1, $2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := e.DB.ExecContext(ctx, query, userID, EventLibraryImported, count)
+	return err
+}
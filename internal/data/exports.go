@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+/* How long a finished archive can be downloaded for before it is thrown away */
+const ExportTTL = 7 * 24 * time.Hour
+
+type Export struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Status     string     `json:"status"`
+	Archive    []byte     `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+/* Everything we hold about a user, one file per section in the archive. Token hashes and the password are left out */
+var exportSections = []struct {
+	Name  string
+	Query string
+}{
+	{"profile", `SELECT id, created_at, username, email, activated, pending_email, totp_enabled, display_name, bio, avatar_url, location, favourite_genres, website FROM users WHERE id = $1`},
+	{"lists", `SELECT lists.*, ARRAY(SELECT book_id FROM book_list WHERE book_list.list_id = lists.id ORDER BY book_list.id) AS book_ids FROM lists WHERE user_id = $1`},
+	{"reviews", `SELECT * FROM reviews WHERE user_id = $1`},
+	{"review_revisions", `SELECT review_revisions.* FROM review_revisions INNER JOIN reviews ON reviews.id = review_revisions.review_id WHERE reviews.user_id = $1`},
+	{"review_votes", `SELECT * FROM review_votes WHERE user_id = $1`},
+	{"comments", `SELECT * FROM review_comments WHERE user_id = $1`},
+	{"finished_books", `SELECT * FROM finished_books WHERE user_id = $1`},
+	{"goals", `SELECT * FROM goals WHERE user_id = $1`},
+	{"challenges", `SELECT * FROM challenge_participants WHERE user_id = $1`},
+	{"imports", `SELECT * FROM imports WHERE user_id = $1`},
+	{"reports", `SELECT * FROM reports WHERE reporter_id = $1`},
+	{"follows", `SELECT * FROM follows WHERE follower_id = $1`},
+	{"permissions", `SELECT permissions.code FROM permissions INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id WHERE users_permissions.user_id = $1`},
+	{"events", `SELECT * FROM events WHERE user_id = $1`},
+	{"login_failures", `SELECT failures, last_failed_at, locked_until FROM login_failures WHERE scope = 'account' AND key = $1::text`},
+	{"tokens", `SELECT scope, expiry, created_at, last_used_at, user_agent, ip FROM tokens WHERE user_id = $1`},
+}
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+/* Add a new export job */
+func (e ExportModel) Insert(job *Export) error {
+	query := `
+		INSERT INTO exports (user_id, status)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return e.DB.QueryRowContext(ctx, query, job.UserID, job.Status).Scan(&job.ID, &job.CreatedAt)
+}
+
+/* Select an export job, without its archive */
+func (e ExportModel) Get(id int64) (*Export, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, status, error, created_at, finished_at
+		FROM exports
+		WHERE id = $1
+	`
+
+	var job Export
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := e.DB.QueryRowContext(ctx, query, id).Scan(&job.ID, &job.UserID, &job.Status, &job.Error, &job.CreatedAt, &job.FinishedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+/* Select the archive of a finished export */
+func (e ExportModel) GetArchive(id int64) ([]byte, error) {
+	query := `
+		SELECT archive
+		FROM exports
+		WHERE id = $1 AND status = 'completed'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var archive []byte
+	err := e.DB.QueryRowContext(ctx, query, id).Scan(&archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+/* Check whether a user already has an export being put together */
+func (e ExportModel) InProgress(userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM exports WHERE user_id = $1 AND status IN ('pending', 'running'))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := e.DB.QueryRowContext(ctx, query, userID).Scan(&exists)
+	return exists, err
+}
+
+/* Save the status of an export job, along with its archive once there is one */
+func (e ExportModel) Update(job *Export) error {
+	query := `
+		UPDATE exports
+		SET status = $1, archive = $2, error = $3, finished_at = $4
+		WHERE id = $5
+	`
+
+	args := []any{job.Status, job.Archive, job.Error, job.FinishedAt, job.ID}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := e.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+/* Throw away the archive of an export once it has been downloaded */
+func (e ExportModel) Expire(id int64) error {
+	query := `
+		UPDATE exports
+		SET status = 'expired', archive = NULL
+		WHERE id = $1 AND status = 'completed'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := e.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+/* Throw away the archives of exports that finished longer ago than ttl */
+func (e ExportModel) DeleteExpired(ttl time.Duration) error {
+	query := `
+		UPDATE exports
+		SET status = 'expired', archive = NULL
+		WHERE status = 'completed' AND finished_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := e.DB.ExecContext(ctx, query, time.Now().Add(-ttl))
+	return err
+}
+
+/* Gather a user's data as JSON, keyed by section name */
+func (e ExportModel) Collect(userID int64) (map[string]json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sections := make(map[string]json.RawMessage)
+	for _, section := range exportSections {
+		query := `SELECT COALESCE(json_agg(section), '[]') FROM (` + section.Query + `) AS section`
+
+		var content []byte
+		err := e.DB.QueryRowContext(ctx, query, userID).Scan(&content)
+		if err != nil {
+			return nil, err
+		}
+		sections[section.Name] = content
+	}
+	return sections, nil
+}
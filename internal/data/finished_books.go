@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+type FinishedBook struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	BookID     int64     `json:"book_id"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+type FinishedBookModel struct {
+	DB       *sql.DB
+	noEvents bool
+}
+
+/* The same model, without feed events, for logging many finished books at once */
+func (f FinishedBookModel) WithoutEvents() FinishedBookModel {
+	f.noEvents = true
+	return f
+}
+
+/* Mark a book as finished (a second call only moves the finish date) */
+func (f FinishedBookModel) Insert(finished *FinishedBook) error {
+	query := `
+		INSERT INTO finished_books (user_id, book_id, finished_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, book_id) DO UPDATE SET finished_at = EXCLUDED.finished_at
+		RETURNING id, (xmax = 0)
+	`
+
+	args := []any{finished.UserID, finished.BookID, finished.FinishedAt}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := f.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// only the first time a book is finished makes it into the feed, dated when it was finished rather than when it was logged
+	var created bool
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&finished.ID, &created)
+	if err != nil {
+		return err
+	}
+
+	if created && !f.noEvents {
+		err = insertEventAt(ctx, tx, finished.FinishedAt, finished.UserID, EventBookFinished, finished.BookID, 0, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/* Remove the finished mark from a book */
+func (f FinishedBookModel) Delete(userID int64, bookID int64) error {
+	if userID < 1 || bookID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM finished_books
+		WHERE user_id = $1 AND book_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := f.DB.ExecContext(ctx, query, userID, bookID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+/* Validation for a finished book */
+func ValidateFinishedBook(v *validator.Validator, finished *FinishedBook) {
+	v.Check(finished.BookID > 0, "book_id", "must be a positive integer")
+	v.Check(!finished.FinishedAt.IsZero(), "finished_at", "must be provided")
+	v.Check(finished.FinishedAt.Before(time.Now().Add(24*time.Hour)), "finished_at", "must not be in the future")
+}
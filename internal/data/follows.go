@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Follow struct {
+	FollowerID int64     `json:"follower_id"`
+	FolloweeID int64     `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type FollowModel struct {
+	DB *sql.DB
+}
+
+/* Start following a user */
+func (f FollowModel) Insert(follow *Follow) error {
+	query := `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := f.DB.QueryRowContext(ctx, query, follow.FollowerID, follow.FolloweeID).Scan(&follow.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "follows_pkey"`:
+			return ErrDuplicateFollow
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+/* Stop following a user */
+func (f FollowModel) Delete(followerID int64, followeeID int64) error {
+	if followerID < 1 || followeeID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followee_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := f.DB.ExecContext(ctx, query, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+/* Select the users following a user, most recent first */
+func (f FollowModel) GetFollowers(userID int64, filters Filters) ([]*PublicUser, Metadata, error) {
+	return f.getUsers("follower_id", "followee_id", userID, filters)
+}
+
+/* Select the users a user follows, most recent first */
+func (f FollowModel) GetFollowing(userID int64, filters Filters) ([]*PublicUser, Metadata, error) {
+	return f.getUsers("followee_id", "follower_id", userID, filters)
+}
+
+/* Select the public profiles on one side of a user's follows */
+func (f FollowModel) getUsers(listed string, matched string, userID int64, filters Filters) ([]*PublicUser, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), users.id, users.created_at, users.username, users.display_name, users.bio,
+			users.avatar_url, users.location, users.favourite_genres, users.website
+		FROM follows
+		INNER JOIN users ON users.id = follows.%s
+		WHERE follows.%s = $1 AND NOT users.hidden
+		ORDER BY follows.created_at DESC, users.id ASC
+		LIMIT $2 OFFSET $3
+	`, listed, matched)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := f.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	users := []*PublicUser{}
+
+	for rows.Next() {
+		var user PublicUser
+		err := rows.Scan(&totalRecords, &user.ID, &user.CreatedAt, &user.Username, &user.DisplayName, &user.Bio,
+			&user.AvatarURL, &user.Location, pq.Array(&user.FavouriteGenres), &user.Website)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
@@ -0,0 +1,251 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+const (
+	GoalCompleted = "completed"
+	GoalOnTrack   = "on_track"
+	GoalBehind    = "behind"
+	GoalMissed    = "missed"
+)
+
+type Goal struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	Year      int          `json:"year"`
+	Target    int          `json:"target"`
+	Genre     string       `json:"genre,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	Version   int          `json:"-"`
+	Progress  GoalProgress `json:"progress"`
+}
+
+type GoalProgress struct {
+	Finished  int     `json:"finished"`
+	Percent   float64 `json:"percent"`
+	Expected  float64 `json:"expected"`
+	Projected int     `json:"projected"`
+	Status    string  `json:"status"`
+}
+
+type GoalModel struct {
+	DB *sql.DB
+}
+
+/* Counts the books a goal's owner finished in the goal's year (and genre, if any) */
+const goalFinishedCount = `
+	(SELECT COUNT(*)
+	FROM finished_books
+	INNER JOIN books ON books.id = finished_books.book_id
+	WHERE finished_books.user_id = goals.user_id
+	AND EXTRACT(YEAR FROM finished_books.finished_at) = goals.year
+	AND (goals.genre = '' OR LOWER(books.genre) = LOWER(goals.genre)))
+`
+
+/* Add a new reading goal */
+func (g GoalModel) Insert(goal *Goal) error {
+	query := `
+		INSERT INTO goals (user_id, year, target, genre)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version
+	`
+
+	args := []any{goal.UserID, goal.Year, goal.Target, goal.Genre}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, query, args...).Scan(&goal.ID, &goal.CreatedAt, &goal.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "goals_user_id_year_genre_key"`:
+			return ErrDuplicateGoal
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+/* Select a reading goal along with its progress */
+func (g GoalModel) Get(id int64) (*Goal, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, year, target, genre, created_at, version, ` + goalFinishedCount + `
+		FROM goals
+		WHERE id = $1
+	`
+
+	var goal Goal
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, query, id).Scan(&goal.ID, &goal.UserID, &goal.Year, &goal.Target, &goal.Genre, &goal.CreatedAt, &goal.Version, &goal.Progress.Finished)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	goal.calculateProgress(time.Now())
+	return &goal, nil
+}
+
+/* Select all reading goals for one user, most recent year first */
+func (g GoalModel) GetAllForUser(userID int64) ([]*Goal, error) {
+	if userID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, year, target, genre, created_at, version, ` + goalFinishedCount + `
+		FROM goals
+		WHERE user_id = $1
+		ORDER BY year DESC, id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := g.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	goals := []*Goal{}
+	for rows.Next() {
+		var goal Goal
+		err := rows.Scan(&goal.ID, &goal.UserID, &goal.Year, &goal.Target, &goal.Genre, &goal.CreatedAt, &goal.Version, &goal.Progress.Finished)
+		if err != nil {
+			return nil, err
+		}
+		goal.calculateProgress(now)
+		goals = append(goals, &goal)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+/* Update a reading goal */
+func (g GoalModel) Update(goal *Goal) error {
+	query := `
+		UPDATE goals
+		SET year = $1, target = $2, genre = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING version
+	`
+
+	args := []any{goal.Year, goal.Target, goal.Genre, goal.ID, goal.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := g.DB.QueryRowContext(ctx, query, args...).Scan(&goal.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "goals_user_id_year_genre_key"`:
+			return ErrDuplicateGoal
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+/* Delete a reading goal */
+func (g GoalModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM goals
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := g.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+/* Work out the progress of a goal that runs for the whole calendar year */
+func (goal *Goal) calculateProgress(now time.Time) {
+	start := time.Date(goal.Year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	goal.Progress = calculateProgress(goal.Target, goal.Progress.Finished, start, end, now)
+}
+
+/* Compare finished books against an even pace through the period and project the final count */
+func calculateProgress(target int, finished int, start time.Time, end time.Time, now time.Time) GoalProgress {
+	progress := GoalProgress{
+		Finished: finished,
+	}
+	if target < 1 {
+		return progress
+	}
+
+	elapsed := now.Sub(start).Seconds() / end.Sub(start).Seconds()
+	elapsed = math.Max(0, math.Min(1, elapsed))
+
+	progress.Percent = math.Round(math.Min(100, float64(finished)/float64(target)*100)*10) / 10
+	progress.Expected = math.Round(float64(target)*elapsed*10) / 10
+	if elapsed > 0 {
+		progress.Projected = int(math.Round(float64(finished) / elapsed))
+	}
+
+	switch {
+	case finished >= target:
+		progress.Status = GoalCompleted
+	case !now.Before(end):
+		progress.Status = GoalMissed
+	case float64(finished) >= math.Floor(progress.Expected):
+		progress.Status = GoalOnTrack
+	default:
+		progress.Status = GoalBehind
+	}
+
+	return progress
+}
+
+/* Validation for reading goal */
+func ValidateGoal(v *validator.Validator, goal *Goal) {
+	v.Check(goal.Year >= 1900 && goal.Year <= 3000, "year", "must be between 1900 and 3000")
+	v.Check(goal.Target > 0, "target", "must be a positive integer")
+	v.Check(goal.Target <= 10000, "target", "must not be more than 10000")
+	v.Check(len(goal.Genre) <= 50, "genre", "must not be more than 50 bytes long")
+}
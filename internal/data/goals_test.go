@@ -0,0 +1,96 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculateProgress(t *testing.T) {
+	// a 100 day period keeps the expected pace easy to work out by hand
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 100)
+	day := func(n int) time.Time { return start.AddDate(0, 0, n) }
+
+	tests := []struct {
+		name     string
+		target   int
+		finished int
+		now      time.Time
+		want     GoalProgress
+	}{
+		{"no target", 0, 3, day(50), GoalProgress{Finished: 3}},
+		{"before the start", 10, 0, day(-1), GoalProgress{Status: GoalOnTrack}},
+		{"at the start", 10, 0, start, GoalProgress{Status: GoalOnTrack}},
+		{"on pace", 10, 5, day(50), GoalProgress{Finished: 5, Percent: 50, Expected: 5, Projected: 10, Status: GoalOnTrack}},
+		{"ahead", 10, 8, day(50), GoalProgress{Finished: 8, Percent: 80, Expected: 5, Projected: 16, Status: GoalOnTrack}},
+		{"behind", 10, 4, day(50), GoalProgress{Finished: 4, Percent: 40, Expected: 5, Projected: 8, Status: GoalBehind}},
+		{"part of a book is not behind", 10, 2, day(25), GoalProgress{Finished: 2, Percent: 20, Expected: 2.5, Projected: 8, Status: GoalOnTrack}},
+		{"percent is rounded", 3, 1, day(50), GoalProgress{Finished: 1, Percent: 33.3, Expected: 1.5, Projected: 2, Status: GoalOnTrack}},
+		{"completed early", 10, 12, day(50), GoalProgress{Finished: 12, Percent: 100, Expected: 5, Projected: 24, Status: GoalCompleted}},
+		{"last second", 10, 9, end.Add(-time.Second), GoalProgress{Finished: 9, Percent: 90, Expected: 10, Projected: 9, Status: GoalBehind}},
+		{"missed at the end", 10, 9, end, GoalProgress{Finished: 9, Percent: 90, Expected: 10, Projected: 9, Status: GoalMissed}},
+		{"missed after the end", 10, 9, day(110), GoalProgress{Finished: 9, Percent: 90, Expected: 10, Projected: 9, Status: GoalMissed}},
+		{"completed at the end", 10, 10, end, GoalProgress{Finished: 10, Percent: 100, Expected: 10, Projected: 10, Status: GoalCompleted}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateProgress(tt.target, tt.finished, start, end, tt.now)
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoalCalculateProgress(t *testing.T) {
+	// 2024 is a leap year, so a target of 366 is one book a day
+	tests := []struct {
+		name     string
+		finished int
+		now      time.Time
+		want     GoalProgress
+	}{
+		{"before the year", 0, time.Date(2023, time.December, 31, 23, 59, 59, 0, time.UTC), GoalProgress{Status: GoalOnTrack}},
+		{"first moment", 0, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), GoalProgress{Status: GoalOnTrack}},
+		{"halfway", 183, time.Date(2024, time.July, 2, 0, 0, 0, 0, time.UTC), GoalProgress{Finished: 183, Percent: 50, Expected: 183, Projected: 366, Status: GoalOnTrack}},
+		{"last moment", 0, time.Date(2024, time.December, 31, 23, 59, 59, 0, time.UTC), GoalProgress{Expected: 366, Status: GoalBehind}},
+		{"next year", 0, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), GoalProgress{Expected: 366, Status: GoalMissed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goal := &Goal{Year: 2024, Target: 366, Progress: GoalProgress{Finished: tt.finished}}
+			goal.calculateProgress(tt.now)
+			if goal.Progress != tt.want {
+				t.Errorf("got %+v, want %+v", goal.Progress, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallengeHasEnded(t *testing.T) {
+	challenge := &Challenge{
+		StartsAt: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:   time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"first day", time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC), false},
+		{"last day", time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC), false},
+		{"last second", time.Date(2024, time.March, 31, 23, 59, 59, 0, time.UTC), false},
+		{"day after", time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := challenge.HasEnded(tt.now); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+type Import struct {
+	ID              int64      `json:"id"`
+	UserID          int64      `json:"user_id"`
+	Source          string     `json:"source"`
+	Status          string     `json:"status"`
+	Total           int        `json:"total"`
+	Processed       int        `json:"processed"`
+	BooksMatched    int        `json:"books_matched"`
+	BooksCreated    int        `json:"books_created"`
+	ListsCreated    int        `json:"lists_created"`
+	ReviewsImported int        `json:"reviews_imported"`
+	ReadsImported   int        `json:"reads_imported"`
+	Skipped         int        `json:"skipped"`
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+type ImportModel struct {
+	DB *sql.DB
+}
+
+/* Add a new import job */
+func (i ImportModel) Insert(job *Import) error {
+	query := `
+		INSERT INTO imports (user_id, source, status, total)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	args := []any{job.UserID, job.Source, job.Status, job.Total}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return i.DB.QueryRowContext(ctx, query, args...).Scan(&job.ID, &job.CreatedAt)
+}
+
+/* Select an import job */
+func (i ImportModel) Get(id int64) (*Import, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, source, status, total, processed, books_matched, books_created,
+			lists_created, reviews_imported, reads_imported, skipped, error, created_at, finished_at
+		FROM imports
+		WHERE id = $1
+	`
+
+	var job Import
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := i.DB.QueryRowContext(ctx, query, id).Scan(&job.ID, &job.UserID, &job.Source, &job.Status, &job.Total, &job.Processed, &job.BooksMatched, &job.BooksCreated,
+		&job.ListsCreated, &job.ReviewsImported, &job.ReadsImported, &job.Skipped, &job.Error, &job.CreatedAt, &job.FinishedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &job, nil
+}
+
+/* Save the status and counters of an import job */
+func (i ImportModel) Update(job *Import) error {
+	query := `
+		UPDATE imports
+		SET status = $1, processed = $2, books_matched = $3, books_created = $4, lists_created = $5,
+			reviews_imported = $6, reads_imported = $7, skipped = $8, error = $9, finished_at = $10
+		WHERE id = $11
+	`
+
+	args := []any{job.Status, job.Processed, job.BooksMatched, job.BooksCreated, job.ListsCreated,
+		job.ReviewsImported, job.ReadsImported, job.Skipped, job.Error, job.FinishedAt, job.ID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := i.DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -7,49 +7,109 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/thats-insane/awt-final/internal/screening"
 	"github.com/thats-insane/awt-final/internal/validator"
 )
 
 type List struct {
-	ID         int64  `json:"id"`
-	Name       string `json:"name"`
-	Desc       string `json:"description"`
-	UserID     int64  `json:"user_id"`
-	BookListID int64  `json:"books"`
-	Status     string `json:"status"`
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Desc       string     `json:"description"`
+	UserID     int64      `json:"user_id"`
+	BookListID int64      `json:"books"`
+	Status     string     `json:"status"`
+	ForkedFrom *int64     `json:"forked_from,omitempty"`
+	ForkCount  int        `json:"fork_count"`
+	Kind       string     `json:"kind"`
+	Query      *BookQuery `json:"query,omitempty"`
+	Hidden     bool       `json:"hidden,omitempty"`
 }
 
+const (
+	ListManual = "manual"
+	ListSmart  = "smart"
+)
+
 type BookList struct {
 	ID     int64 `json:"id"`
 	ListID int64 `json:"list_id"`
 	BookID int64 `json:"book_id"`
 }
 
+/* A book in a bulk request, identified by its ID or its ISBN */
+type BookRef struct {
+	BookID int64  `json:"book_id,omitempty"`
+	ISBN   string `json:"isbn,omitempty"`
+}
+
+type BookListResult struct {
+	BookRef
+	Status string `json:"status"`
+}
+
+const (
+	BookListAdded     = "added"
+	BookListDuplicate = "duplicate"
+	BookListRemoved   = "removed"
+	BookListNotInList = "not_in_list"
+	BookListNotFound  = "book_not_found"
+)
+
 type ListModel struct {
 	DB *sql.DB
+	// set for bulk work such as imports, which records one event of its own instead
+	noEvents bool
+}
+
+/* A copy of the model that doesn't add anything to the feed */
+func (l ListModel) WithoutEvents() ListModel {
+	l.noEvents = true
+	return l
 }
 
-/* Add a new reading list to the database */
+/* Add a new reading list to the database, the list_created event goes to its owner's followers so the owner must be the user creating it */
 func (l ListModel) Insert(list *List) error {
 	query := `
-		INSERT INTO lists(name, description, user_id, book_list_id, status)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO lists(name, description, user_id, book_list_id, status, kind, query)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7)
 		RETURNING id
 	`
 
-	args := []any{list.Name, list.Desc, list.UserID, list.BookListID, list.Status}
+	if list.Kind == "" {
+		list.Kind = ListManual
+	}
+	args := []any{list.Name, list.Desc, list.UserID, list.BookListID, list.Status, list.Kind, list.Query}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return l.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID)
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&list.ID)
+	if err != nil {
+		return err
+	}
+
+	if !l.noEvents {
+		err = insertEvent(ctx, tx, list.UserID, EventListCreated, 0, 0, list.ID)
+		if err != nil {
+			return err
+		}
+	}
 
+	return tx.Commit()
 }
 
 /* Select all reading lists from database */
 func (l ListModel) GetAll(filters Filters) ([]*List, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT id, name, description, user_id, book_list_id, status
+		SELECT COUNT(*) OVER(), id, name, description, COALESCE(user_id, 0), COALESCE(book_list_id, 0), status, forked_from,
+			(SELECT COUNT(*) FROM lists AS forks WHERE forks.forked_from = lists.id), kind, query, hidden
 		FROM lists
+		WHERE NOT hidden
 		ORDER BY %s %s, id ASC
 		LIMIT $1 OFFSET $2
 	`, filters.sortColumn(), filters.sortDirection())
@@ -69,7 +129,7 @@ func (l ListModel) GetAll(filters Filters) ([]*List, Metadata, error) {
 
 	for rows.Next() {
 		var list List
-		err := rows.Scan(&list.ID, &list.Name, &list.Desc, &list.UserID, &list.BookListID, &list.Status)
+		err := rows.Scan(&totalRecords, &list.ID, &list.Name, &list.Desc, &list.UserID, &list.BookListID, &list.Status, &list.ForkedFrom, &list.ForkCount, &list.Kind, &list.Query, &list.Hidden)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -98,8 +158,25 @@ func (l ListModel) AddBook(booklist *BookList) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return l.DB.QueryRowContext(ctx, query, args...).Scan(&booklist.ID)
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&booklist.ID)
+	if err != nil {
+		return err
+	}
+
+	if !l.noEvents {
+		err = insertListBookEvent(ctx, tx, booklist.ListID, booklist.BookID)
+		if err != nil {
+			return err
+		}
+	}
 
+	return tx.Commit()
 }
 
 /* Select specific reading list from database */
@@ -109,7 +186,8 @@ func (l ListModel) Get(id int64) (*List, error) {
 	}
 
 	query := `
-		SELECT id, name, description, user_id, book_list_id, status 
+		SELECT id, name, description, COALESCE(user_id, 0), COALESCE(book_list_id, 0), status, forked_from,
+			(SELECT COUNT(*) FROM lists AS forks WHERE forks.forked_from = lists.id), kind, query, hidden
 		FROM lists
 		WHERE id = $1
 	`
@@ -118,7 +196,34 @@ func (l ListModel) Get(id int64) (*List, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := l.DB.QueryRowContext(ctx, query, id).Scan(&list.ID, &list.Name, &list.Desc, &list.UserID, &list.BookListID, &list.Status)
+	err := l.DB.QueryRowContext(ctx, query, id).Scan(&list.ID, &list.Name, &list.Desc, &list.UserID, &list.BookListID, &list.Status, &list.ForkedFrom, &list.ForkCount, &list.Kind, &list.Query, &list.Hidden)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+/* Select one of a user's manual reading lists by name, the oldest one if they have several with the same name */
+func (l ListModel) GetByName(userID int64, name string) (*List, error) {
+	query := `
+		SELECT id, name, description, COALESCE(user_id, 0), COALESCE(book_list_id, 0), status, forked_from,
+			(SELECT COUNT(*) FROM lists AS forks WHERE forks.forked_from = lists.id), kind, query, hidden
+		FROM lists
+		WHERE user_id = $1 AND name = $2 AND kind = 'manual'
+		ORDER BY id
+		LIMIT 1
+	`
+
+	var list List
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := l.DB.QueryRowContext(ctx, query, userID, name).Scan(&list.ID, &list.Name, &list.Desc, &list.UserID, &list.BookListID, &list.Status, &list.ForkedFrom, &list.ForkCount, &list.Kind, &list.Query, &list.Hidden)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -130,6 +235,53 @@ func (l ListModel) Get(id int64) (*List, error) {
 	return &list, nil
 }
 
+/* Copy a reading list and all of its books into a new list, remembering where it came from */
+func (l ListModel) Fork(source *List, fork *List) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO lists (name, description, user_id, book_list_id, status, forked_from, kind, query)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, $8)
+		RETURNING id
+	`
+
+	args := []any{fork.Name, fork.Desc, fork.UserID, fork.BookListID, fork.Status, source.ID, fork.Kind, fork.Query}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&fork.ID)
+	if err != nil {
+		return err
+	}
+
+	if !l.noEvents {
+		err = insertEvent(ctx, tx, fork.UserID, EventListCreated, 0, 0, fork.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO book_list (list_id, book_id)
+		SELECT $1, book_id
+		FROM book_list
+		WHERE list_id = $2
+		ORDER BY id
+	`
+
+	_, err = tx.ExecContext(ctx, query, fork.ID, source.ID)
+	if err != nil {
+		return err
+	}
+
+	fork.ForkedFrom = &source.ID
+	return tx.Commit()
+}
+
 /* Select all books in the reading list from the database */
 func (l ListModel) GetBooks(id int64) (*BookList, error) {
 	if id < 1 {
@@ -158,16 +310,16 @@ func (l ListModel) GetBooks(id int64) (*BookList, error) {
 	return &booklist, nil
 }
 
-/* Update a reading list's entry */
+/* Update a reading list's entry, the owner never changes once the list is created */
 func (l ListModel) Update(list *List) error {
 	query := `
-		UPDATE list
-		SET name = $1, description = $2, user_id = $3, book_list_id = $4, status = $5
+		UPDATE lists
+		SET name = $1, description = $2, book_list_id = NULLIF($3, 0), status = $4, query = $5
 		WHERE id = $6
 		RETURNING id
 	`
 
-	args := []any{list.Name, list.Desc, &list.UserID, &list.BookListID, &list.Status}
+	args := []any{list.Name, list.Desc, list.BookListID, list.Status, list.Query, list.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -205,44 +357,194 @@ func (l ListModel) Delete(id int64) error {
 	return nil
 }
 
-/* Delete books from reading list */
-func (l ListModel) DeleteBook(id int64) error {
-	if id < 1 {
-		return nil
+/* Add several books to a reading list in one transaction, reporting what happened to each */
+func (l ListModel) AddBooks(listID int64, refs []BookRef) ([]*BookListResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
 	query := `
-		DELETE FROM book_list
-		WHERE book_id = $1
+		INSERT INTO book_list (list_id, book_id)
+		VALUES ($1, $2)
+		ON CONFLICT (list_id, book_id) DO NOTHING
+		RETURNING id
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	results := []*BookListResult{}
+	for _, ref := range refs {
+		result := &BookListResult{BookRef: ref}
+		results = append(results, result)
 
-	result, err := l.DB.ExecContext(ctx, query, id)
+		bookID, err := resolveBookRef(ctx, tx, ref)
+		if err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				result.Status = BookListNotFound
+				continue
+			}
+			return nil, err
+		}
+		result.BookID = bookID
+
+		var id int64
+		err = tx.QueryRowContext(ctx, query, listID, bookID).Scan(&id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				result.Status = BookListDuplicate
+				continue
+			}
+			return nil, err
+		}
+		result.Status = BookListAdded
+
+		if !l.noEvents {
+			err = insertListBookEvent(ctx, tx, listID, bookID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = tx.Commit()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return results, nil
+}
+
+/* Record a book being added to a list, on behalf of whoever owns the list */
+func insertListBookEvent(ctx context.Context, tx *sql.Tx, listID int64, bookID int64) error {
+	var ownerID int64
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(user_id, 0) FROM lists WHERE id = $1`, listID).Scan(&ownerID)
 	if err != nil {
 		return err
 	}
+	return insertEvent(ctx, tx, ownerID, EventListBookAdded, bookID, 0, listID)
+}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+/* Remove several books from a reading list in one transaction, reporting what happened to each */
+func (l ListModel) RemoveBooks(listID int64, refs []BookRef) ([]*BookListResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	return nil
+	query := `
+		DELETE FROM book_list
+		WHERE list_id = $1 AND book_id = $2
+	`
+
+	results := []*BookListResult{}
+	for _, ref := range refs {
+		result := &BookListResult{BookRef: ref}
+		results = append(results, result)
+
+		bookID, err := resolveBookRef(ctx, tx, ref)
+		if err != nil {
+			if errors.Is(err, ErrRecordNotFound) {
+				result.Status = BookListNotFound
+				continue
+			}
+			return nil, err
+		}
+		result.BookID = bookID
+
+		res, err := tx.ExecContext(ctx, query, listID, bookID)
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected == 0 {
+			result.Status = BookListNotInList
+			continue
+		}
+		result.Status = BookListRemoved
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+/* Look up the ID of the book a reference points to, either by its ID or its ISBN */
+func resolveBookRef(ctx context.Context, tx *sql.Tx, ref BookRef) (int64, error) {
+	query := `
+		SELECT id
+		FROM books
+		WHERE id = $1
+	`
+	arg := any(ref.BookID)
+	if ref.ISBN != "" {
+		query = `
+			SELECT id
+			FROM books
+			WHERE isbn = $1
+		`
+		arg = ref.ISBN
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, query, arg).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+/* Validation for the books sent in a bulk list request */
+func ValidateBookRefs(v *validator.Validator, refs []BookRef) {
+	v.Check(len(refs) > 0, "books", "must contain at least one book id or isbn")
+	v.Check(len(refs) <= 100, "books", "must not contain more than 100 books")
+
+	for _, ref := range refs {
+		if ref.ISBN != "" {
+			v.Check(len(ref.ISBN) <= 13, "isbns", "must not be more than 13 bytes long")
+			continue
+		}
+		v.Check(ref.BookID > 0, "book_ids", "must be positive integers")
+	}
 }
 
 /* Validation for reading list */
-func ValidateList(v *validator.Validator, list *List) {
+func ValidateList(v *validator.Validator, screener *screening.Screener, list *List) {
 	v.Check(list.Name != "", "list", "must be provided")
 	v.Check(len(list.Name) <= 100, "list", "must not be more than 100 bytes long")
 	v.Check(list.UserID > 0, "list", "must be a positive integer")
-	v.Check(list.BookListID > 0, "list", "must be a positive integer")
+	v.Check(list.Kind == ListManual || list.Kind == ListSmart, "kind", "must be manual or smart")
+	if list.Kind == ListSmart {
+		v.Check(list.Query != nil, "query", "must be provided for a smart list")
+		if list.Query != nil {
+			ValidateBookQuery(v, list.Query)
+		}
+	} else {
+		// lists keep their books in book_list, so this older link is optional
+		v.Check(list.BookListID >= 0, "books", "must not be negative")
+		v.Check(list.Query == nil, "query", "must only be provided for a smart list")
+	}
 	v.Check(list.Desc != "", "list", "must be provided")
 	v.Check(len(list.Desc) <= 225, "list", "must not be more than 225 bytes long")
 	v.Check(list.Status == "reading" || list.Status == "finished", "list", "must be reading or finished")
+
+	screenText(v, screener, poster(list.ID, list.UserID), screening.Field{Name: "list", Text: list.Name}, screening.Field{Name: "list", Text: list.Desc})
 }
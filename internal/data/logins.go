@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/* What failed logins are counted against */
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+/* The first retry after a failed login has to wait this long, and each failure after that doubles it */
+const loginBackoffBase = time.Second
+
+/* Failed logins for one account or IP, kept in the database so a restart doesn't clear them */
+type LoginFailures struct {
+	Scope        string
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+/* How long until another login can be tried, the lockout if there is one, otherwise the backoff from the last failure. The backoff stays under the lockout halved once for each try left, so it never reaches the lockout before maxFailures does */
+func (l *LoginFailures) Wait(maxFailures int, lockout time.Duration) time.Duration {
+	if l.LockedUntil != nil {
+		if wait := time.Until(*l.LockedUntil); wait > 0 {
+			return wait
+		}
+	}
+	if l.Failures < 1 {
+		return 0
+	}
+
+	backoff := lockout
+	if l.Failures < 32 {
+		backoff = min(backoff, loginBackoffBase<<(l.Failures-1))
+	}
+	if left := maxFailures - l.Failures; left > 0 {
+		backoff = min(backoff, lockout>>min(left, 62))
+	}
+	return max(time.Until(l.LastFailedAt.Add(backoff)), 0)
+}
+
+type LoginModel struct {
+	DB *sql.DB
+}
+
+/* Select the failed logins for an account or IP */
+func (l LoginModel) Get(scope string, key string) (*LoginFailures, error) {
+	query := `
+		SELECT scope, key, failures, last_failed_at, locked_until
+		FROM login_failures
+		WHERE scope = $1 AND key = $2
+	`
+
+	var failures LoginFailures
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := l.DB.QueryRowContext(ctx, query, scope, key).Scan(&failures.Scope, &failures.Key, &failures.Failures, &failures.LastFailedAt, &failures.LockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &failures, nil
+}
+
+/* Count a failed login and lock the account or IP once it reaches maxFailures. Failures older than the lockout are forgotten, and locked reports whether this one started a lockout */
+func (l LoginModel) RecordFailure(scope string, key string, maxFailures int, lockout time.Duration) (*LoginFailures, bool, error) {
+	query := `
+		INSERT INTO login_failures (scope, key, failures)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (scope, key) DO UPDATE
+		SET failures = CASE WHEN login_failures.last_failed_at < NOW() - make_interval(secs => $3) THEN 1 ELSE login_failures.failures + 1 END,
+			last_failed_at = NOW()
+		RETURNING scope, key, failures, last_failed_at, locked_until
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var failures LoginFailures
+	err = tx.QueryRowContext(ctx, query, scope, key, lockout.Seconds()).Scan(&failures.Scope, &failures.Key, &failures.Failures, &failures.LastFailedAt, &failures.LockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	locked := false
+	if failures.Failures >= maxFailures && (failures.LockedUntil == nil || failures.LockedUntil.Before(failures.LastFailedAt)) {
+		query = `
+			UPDATE login_failures
+			SET locked_until = last_failed_at + make_interval(secs => $3)
+			WHERE scope = $1 AND key = $2
+			RETURNING locked_until
+		`
+
+		err = tx.QueryRowContext(ctx, query, scope, key, lockout.Seconds()).Scan(&failures.LockedUntil)
+		if err != nil {
+			return nil, false, err
+		}
+		locked = true
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+	return &failures, locked, nil
+}
+
+/* Forget the failed logins for an account or IP, after a successful login or an unlock */
+func (l LoginModel) Reset(scope string, key string) error {
+	query := `
+		DELETE FROM login_failures
+		WHERE scope = $1 AND key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := l.DB.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+/* Halve the failed logins for an account or IP after a successful login, so a shared IP recovers without one good login wiping out a run of guesses. A lockout already in place is left alone */
+func (l LoginModel) Decay(scope string, key string) error {
+	query := `
+		UPDATE login_failures
+		SET failures = failures / 2
+		WHERE scope = $1 AND key = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := l.DB.ExecContext(ctx, query, scope, key)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		DELETE FROM login_failures
+		WHERE scope = $1 AND key = $2 AND failures = 0 AND (locked_until IS NULL OR locked_until < NOW())
+	`
+
+	_, err = l.DB.ExecContext(ctx, query, scope, key)
+	return err
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginFailuresWait(t *testing.T) {
+	const lockout = 15 * time.Minute
+	locked := time.Now().Add(10 * time.Minute)
+	expired := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		failures    LoginFailures
+		maxFailures int
+		want        time.Duration
+	}{
+		{"no failures", LoginFailures{}, 5, 0},
+		{"first failure", LoginFailures{Failures: 1}, 5, time.Second},
+		{"doubles", LoginFailures{Failures: 3}, 5, 4 * time.Second},
+		{"last try before the lockout", LoginFailures{Failures: 4}, 5, 8 * time.Second},
+		{"halved for each try left", LoginFailures{Failures: 10}, 12, lockout / 4},
+		{"last try of many", LoginFailures{Failures: 19}, 20, lockout / 2},
+		{"many tries left", LoginFailures{Failures: 10}, 20, lockout >> 10},
+		{"past the max", LoginFailures{Failures: 40}, 5, lockout},
+		{"locked", LoginFailures{Failures: 5, LockedUntil: &locked}, 5, 10 * time.Minute},
+		{"lock expired", LoginFailures{Failures: 1, LockedUntil: &expired}, 5, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := tt.failures
+			failures.LastFailedAt = time.Now()
+
+			got := failures.Wait(tt.maxFailures, lockout)
+			// the wait is counted from now, so allow for the time the test takes
+			if got > tt.want || got < tt.want-time.Second {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginFailuresWaitBelowLockout(t *testing.T) {
+	const lockout = 15 * time.Minute
+
+	for _, maxFailures := range []int{1, 5, 20, 100} {
+		previous := time.Duration(0)
+		for failures := 1; failures < maxFailures; failures++ {
+			l := LoginFailures{Failures: failures, LastFailedAt: time.Now()}
+			wait := l.Wait(maxFailures, lockout)
+			if wait >= lockout {
+				t.Fatalf("max %d: failure %d waits %v, as long as the lockout", maxFailures, failures, wait)
+			}
+			if wait+time.Second < previous {
+				t.Fatalf("max %d: failure %d waits %v, less than the failure before", maxFailures, failures, wait)
+			}
+			previous = wait
+		}
+	}
+}
+
+func TestLoginFailuresWaitSinceLastFailure(t *testing.T) {
+	l := LoginFailures{Failures: 3, LastFailedAt: time.Now().Add(-time.Minute)}
+	if wait := l.Wait(5, 15*time.Minute); wait != 0 {
+		t.Errorf("the backoff should have passed, got %v", wait)
+	}
+}
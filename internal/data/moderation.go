@@ -0,0 +1,339 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+const (
+	ActionHide      = "hide"
+	ActionUnhide    = "unhide"
+	ActionActioned  = "report_actioned"
+	ActionDismissed = "report_dismissed"
+)
+
+/* The kinds of content that can be reported and hidden, and the tables they live in */
+var moderationTargets = map[string]string{
+	"review":  "reviews",
+	"list":    "lists",
+	"comment": "review_comments",
+	"user":    "users",
+}
+
+var ReportReasons = []string{"spam", "abuse", "spoiler"}
+
+/* A report made by a user, or by text screening when ReporterID is zero */
+type Report struct {
+	ID         int64      `json:"id"`
+	ReporterID int64      `json:"reporter_id,omitempty"`
+	TargetType string     `json:"target_type"`
+	TargetID   int64      `json:"target_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedBy *int64     `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+type ModerationAction struct {
+	ID          int64     `json:"id"`
+	ModeratorID int64     `json:"moderator_id"`
+	Action      string    `json:"action"`
+	TargetType  string    `json:"target_type"`
+	TargetID    int64     `json:"target_id"`
+	ReportID    *int64    `json:"report_id,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ReportModel struct {
+	DB *sql.DB
+}
+
+type ModerationModel struct {
+	DB *sql.DB
+}
+
+/* Add a new report */
+func (m ReportModel) Insert(report *Report) error {
+	query := `
+		INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`
+
+	args := []any{report.ReporterID, report.TargetType, report.TargetID, report.Reason, report.Details}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reports_open_reporter_target_key"`:
+			return ErrDuplicateReport
+		case err.Error() == `pq: duplicate key value violates unique constraint "reports_open_system_target_key"`:
+			return ErrDuplicateReport
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+/* Select a report */
+func (m ReportModel) Get(id int64) (*Report, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, COALESCE(reporter_id, 0), target_type, target_id, reason, details, status, created_at, resolved_by, resolved_at
+		FROM reports
+		WHERE id = $1
+	`
+
+	var report Report
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&report.ID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.Reason, &report.Details, &report.Status, &report.CreatedAt, &report.ResolvedBy, &report.ResolvedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &report, nil
+}
+
+/* Select the reports in the moderation queue, optionally narrowed down by status and target type */
+func (m ReportModel) GetAll(status string, targetType string, filters Filters) ([]*Report, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, COALESCE(reporter_id, 0), target_type, target_id, reason, details, status, created_at, resolved_by, resolved_at
+		FROM reports
+		WHERE (status = $1 OR $1 = '')
+		AND (target_type = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, targetType, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	reports := []*Report{}
+
+	for rows.Next() {
+		var report Report
+		err := rows.Scan(&totalRecords, &report.ID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.Reason, &report.Details, &report.Status, &report.CreatedAt, &report.ResolvedBy, &report.ResolvedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reports = append(reports, &report)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return reports, metadata, nil
+}
+
+/* Check that the content a report points at exists */
+func (m ReportModel) TargetExists(targetType string, targetID int64) (bool, error) {
+	table, ok := moderationTargets[targetType]
+	if !ok {
+		return false, nil
+	}
+
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1)`, table)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, targetID).Scan(&exists)
+	return exists, err
+}
+
+/* Hide or unhide a piece of content and log the action */
+func (m ModerationModel) SetHidden(action *ModerationAction, hidden bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setHidden(ctx, tx, action.TargetType, action.TargetID, hidden)
+	if err != nil {
+		return err
+	}
+
+	err = insertAction(ctx, tx, action)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/* Close an open report as actioned or dismissed, optionally hiding what it points at, and log the action */
+func (m ModerationModel) Resolve(report *Report, action *ModerationAction, hide bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// only open reports can be resolved, so two moderators can't resolve the same report
+	query := `
+		UPDATE reports
+		SET status = $1, resolved_by = $2, resolved_at = NOW()
+		WHERE id = $3 AND status = 'open'
+		RETURNING resolved_by, resolved_at
+	`
+	err = tx.QueryRowContext(ctx, query, report.Status, action.ModeratorID, report.ID).Scan(&report.ResolvedBy, &report.ResolvedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if hide {
+		err = setHidden(ctx, tx, report.TargetType, report.TargetID, true)
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	err = insertAction(ctx, tx, action)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/* Select the moderation action log, newest first */
+func (m ModerationModel) GetAll(filters Filters) ([]*ModerationAction, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, COALESCE(moderator_id, 0), action, target_type, target_id, report_id, note, created_at
+		FROM moderation_actions
+		ORDER BY %s %s, id DESC
+		LIMIT $1 OFFSET $2
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	actions := []*ModerationAction{}
+
+	for rows.Next() {
+		var action ModerationAction
+		err := rows.Scan(&totalRecords, &action.ID, &action.ModeratorID, &action.Action, &action.TargetType, &action.TargetID, &action.ReportID, &action.Note, &action.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		actions = append(actions, &action)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return actions, metadata, nil
+}
+
+func setHidden(ctx context.Context, tx *sql.Tx, targetType string, targetID int64, hidden bool) error {
+	table, ok := moderationTargets[targetType]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET hidden = $1 WHERE id = $2`, table)
+
+	result, err := tx.ExecContext(ctx, query, hidden, targetID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func insertAction(ctx context.Context, tx *sql.Tx, action *ModerationAction) error {
+	query := `
+		INSERT INTO moderation_actions (moderator_id, action, target_type, target_id, report_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	args := []any{action.ModeratorID, action.Action, action.TargetType, action.TargetID, action.ReportID, action.Note}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&action.ID, &action.CreatedAt)
+}
+
+/* Validation for a report */
+func ValidateReport(v *validator.Validator, report *Report) {
+	_, ok := moderationTargets[report.TargetType]
+	v.Check(ok, "target_type", "must be one of review, list, comment or user")
+	v.Check(report.TargetID > 0, "target_id", "must be a positive integer")
+	v.Check(validator.PermittedValue(report.Reason, ReportReasons...), "reason", "must be one of spam, abuse or spoiler")
+	v.Check(len(report.Details) <= 1000, "details", "must not be more than 1000 bytes long")
+}
+
+/* Validation for a hide or unhide action */
+func ValidateModerationAction(v *validator.Validator, action *ModerationAction) {
+	_, ok := moderationTargets[action.TargetType]
+	v.Check(ok, "target_type", "must be one of review, list, comment or user")
+	v.Check(action.TargetID > 0, "target_id", "must be a positive integer")
+	v.Check(len(action.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
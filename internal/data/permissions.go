@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* The permission codes seeded by the migrations */
+const (
+	PermissionBooksWrite      = "books:write"
+	PermissionReviewsWrite    = "reviews:write"
+	PermissionListsWrite      = "lists:write"
+	PermissionReviewsModerate = "reviews:moderate"
+	PermissionUsersAdmin      = "users:admin"
+)
+
+var AllPermissions = []string{PermissionBooksWrite, PermissionReviewsWrite, PermissionListsWrite, PermissionReviewsModerate, PermissionUsersAdmin}
+
+/* What every new account is allowed to do */
+var DefaultPermissions = []string{PermissionReviewsWrite, PermissionListsWrite}
+
+type Permissions []string
+
+/* Shared with UserModel.Insert, which grants the default permissions in the same transaction as the new account */
+const addPermissionsQuery = `
+	INSERT INTO users_permissions (user_id, permission_id)
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING
+`
+
+/* Check whether a permission code is in the set */
+func (p Permissions) Include(code string) bool {
+	for i := range p {
+		if p[i] == code {
+			return true
+		}
+	}
+	return false
+}
+
+/* Check a list of permission codes before granting or revoking them */
+func ValidatePermissions(v *validator.Validator, codes []string) {
+	v.Check(len(codes) > 0, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(codes), "permissions", "must not contain duplicate values")
+	for _, code := range codes {
+		v.Check(validator.PermittedValue(code, AllPermissions...), "permissions", "must only contain known permission codes")
+	}
+}
+
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+/* Select the permission codes a user holds */
+func (p PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var code string
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, code)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+/* Grant permissions to a user, ones they already hold are left alone */
+func (p PermissionModel) AddForUser(userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, addPermissionsQuery, userID, pq.Array(codes))
+	return err
+}
+
+/* Take permissions away from a user, ones they don't hold are ignored */
+func (p PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id AND users_permissions.user_id = $1 AND permissions.code = ANY($2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
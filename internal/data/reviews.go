@@ -5,37 +5,191 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"github.com/thats-insane/awt-final/internal/screening"
 	"github.com/thats-insane/awt-final/internal/validator"
 )
 
 type Review struct {
-	ID        int64     `json:"id"`
-	BookID    int64     `json:"book_id"`
-	UserID    int64     `json:"user_id"`
-	Rating    int64     `json:"rating"`
-	Desc      string    `json:"description"`
-	CreatedAt time.Time `json:"-"`
+	ID         int64      `json:"id"`
+	BookID     int64      `json:"book_id"`
+	UserID     int64      `json:"user_id"`
+	Rating     float64    `json:"rating"`
+	SubRatings SubRatings `json:"sub_ratings"`
+	Desc       string     `json:"body_markdown"`
+	BodyHTML   string     `json:"body_html"`
+	Spoiler    bool       `json:"spoiler"`
+	Segments   []Segment  `json:"segments"`
+	Hidden     bool       `json:"hidden,omitempty"`
+	Helpful    int        `json:"helpful_count"`
+	Unhelpful  int        `json:"unhelpful_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+	EditCount  int        `json:"edit_count"`
 }
 
+/* An earlier version of a review, kept each time the review is edited */
+type ReviewRevision struct {
+	ID         int64      `json:"id"`
+	ReviewID   int64      `json:"review_id"`
+	Rating     float64    `json:"rating"`
+	SubRatings SubRatings `json:"sub_ratings"`
+	Desc       string     `json:"body_markdown"`
+	BodyHTML   string     `json:"body_html"`
+	Spoiler    bool       `json:"spoiler"`
+	WrittenAt  time.Time  `json:"written_at"`
+	ReplacedAt time.Time  `json:"replaced_at"`
+}
+
+/* Optional ratings of parts of a book, in half stars like the overall rating */
+type SubRatings struct {
+	Plot       *float64 `json:"plot,omitempty"`
+	Characters *float64 `json:"characters,omitempty"`
+	Prose      *float64 `json:"prose,omitempty"`
+	Pacing     *float64 `json:"pacing,omitempty"`
+}
+
+/* How a book has been rated across its visible reviews, sub-ratings average only the reviews that gave one */
+type RatingSummary struct {
+	Reviews    int        `json:"review_count"`
+	Average    float64    `json:"average"`
+	SubRatings SubRatings `json:"sub_ratings"`
+}
+
+/* Friendlier names for the sort orders of a book's reviews */
+var ReviewSortAliases = map[string]string{
+	"helpful": "-helpful_count",
+	"newest":  "-created_at",
+	"oldest":  "created_at",
+	"highest": "-rating",
+	"lowest":  "rating",
+}
+
+/* Sort values accepted by review listings */
+var ReviewSortSafeList = []string{"id", "created_at", "rating", "helpful_count", "-id", "-created_at", "-rating", "-helpful_count"}
+
 type ReviewModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	noEvents bool
+}
+
+/* The same model, except the reviews it writes are left out of followers' feeds */
+func (r ReviewModel) WithoutEvents() ReviewModel {
+	r.noEvents = true
+	return r
 }
 
 /* Add a new review */
 func (r ReviewModel) Insert(review *Review) error {
 	query := `
-		INSERT INTO reviews (book_id, user_id, rating, description)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO reviews (book_id, user_id, rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at
 	`
-	args := []any{review.BookID, review.UserID, review.Rating, review.Desc}
+	err := review.render()
+	if err != nil {
+		return err
+	}
+	sub := review.SubRatings
+	args := []any{review.BookID, review.UserID, review.Rating, sub.Plot, sub.Characters, sub.Prose, sub.Pacing, review.Desc, review.BodyHTML, review.Spoiler}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID)
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_book_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	if !r.noEvents {
+		err = insertEvent(ctx, tx, review.UserID, EventReviewCreated, review.BookID, review.ID, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	review.splitSpoilers()
+	return nil
+}
+
+/* Compares a review with the one an upsert would replace it with, body_html is left out since it follows from the description */
+const reviewChanged = `(reviews.rating, reviews.plot_rating, reviews.characters_rating, reviews.prose_rating, reviews.pacing_rating, reviews.description, reviews.spoiler)
+	IS DISTINCT FROM (EXCLUDED.rating, EXCLUDED.plot_rating, EXCLUDED.characters_rating, EXCLUDED.prose_rating, EXCLUDED.pacing_rating, EXCLUDED.description, EXCLUDED.spoiler)`
+
+/* Add a user's review of a book, or replace it if they already have one, keeping what it replaced if it changed. Reports whether it was created */
+func (r ReviewModel) Upsert(review *Review) (bool, error) {
+	err := review.render()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// saving the same review again isn't an edit, so it only goes into the history when something changed
+	sub := review.SubRatings
+	where := `book_id = $1 AND user_id = $2 AND (rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, spoiler)
+		IS DISTINCT FROM ($3::numeric, $4::numeric, $5::numeric, $6::numeric, $7::numeric, $8::text, $9::boolean)`
+	_, err = insertRevision(ctx, tx, where, review.BookID, review.UserID, review.Rating, sub.Plot, sub.Characters, sub.Prose, sub.Pacing, review.Desc, review.Spoiler)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		INSERT INTO reviews (book_id, user_id, rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (book_id, user_id)
+		DO UPDATE SET rating = EXCLUDED.rating, plot_rating = EXCLUDED.plot_rating, characters_rating = EXCLUDED.characters_rating,
+			prose_rating = EXCLUDED.prose_rating, pacing_rating = EXCLUDED.pacing_rating, description = EXCLUDED.description, body_html = EXCLUDED.body_html, spoiler = EXCLUDED.spoiler,
+			updated_at = CASE WHEN ` + reviewChanged + ` THEN NOW() ELSE reviews.updated_at END,
+			edit_count = reviews.edit_count + CASE WHEN ` + reviewChanged + ` THEN 1 ELSE 0 END
+		RETURNING id, helpful_count, unhelpful_count, created_at, updated_at, edit_count, (xmax = 0)
+	`
+	args := []any{review.BookID, review.UserID, review.Rating, sub.Plot, sub.Characters, sub.Prose, sub.Pacing, review.Desc, review.BodyHTML, review.Spoiler}
+
+	// xmax is only zero for a freshly inserted row, an updated row carries the id of the updating transaction
+	var created bool
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.Helpful, &review.Unhelpful, &review.CreatedAt, &review.UpdatedAt, &review.EditCount, &created)
+	if err != nil {
+		return false, err
+	}
+
+	if created && !r.noEvents {
+		err = insertEvent(ctx, tx, review.UserID, EventReviewCreated, review.BookID, review.ID, 0)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	review.splitSpoilers()
+	return created, nil
 }
 
 /* Select a review */
@@ -44,7 +198,7 @@ func (r ReviewModel) Get(id int64) (*Review, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT id, book_id, user_id, rating, description
+		SELECT id, book_id, COALESCE(user_id, 0), rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, hidden, helpful_count, unhelpful_count, created_at, updated_at, edit_count
 		FROM reviews
 		WHERE id = $1
 	`
@@ -52,13 +206,39 @@ func (r ReviewModel) Get(id int64) (*Review, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.DB.QueryRowContext(ctx, query, id).Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.Desc, &review.CreatedAt)
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.SubRatings.Plot, &review.SubRatings.Characters, &review.SubRatings.Prose, &review.SubRatings.Pacing, &review.Desc, &review.BodyHTML, &review.Spoiler, &review.Hidden, &review.Helpful, &review.Unhelpful, &review.CreatedAt, &review.UpdatedAt, &review.EditCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	review.splitSpoilers()
+	return &review, nil
+}
+
+/* Select a user's review of a book */
+func (r ReviewModel) GetForBookUser(bookID int64, userID int64) (*Review, error) {
+	if bookID < 1 || userID < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, book_id, COALESCE(user_id, 0), rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, hidden, helpful_count, unhelpful_count, created_at, updated_at, edit_count
+		FROM reviews
+		WHERE book_id = $1 AND user_id = $2
+	`
+	var review Review
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, bookID, userID).Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.SubRatings.Plot, &review.SubRatings.Characters, &review.SubRatings.Prose, &review.SubRatings.Pacing, &review.Desc, &review.BodyHTML, &review.Spoiler, &review.Hidden, &review.Helpful, &review.Unhelpful, &review.CreatedAt, &review.UpdatedAt, &review.EditCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
 		return nil, err
 	}
+	review.splitSpoilers()
 	return &review, nil
 }
 
@@ -68,9 +248,9 @@ func (r ReviewModel) GetUser(id int64) ([]*Review, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT id, book_id, user_id, rating, description
+		SELECT id, book_id, COALESCE(user_id, 0), rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, hidden, helpful_count, unhelpful_count, created_at, updated_at, edit_count
 		FROM reviews
-		WHERE user_id = $1
+		WHERE user_id = $1 AND NOT hidden
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -85,10 +265,11 @@ func (r ReviewModel) GetUser(id int64) ([]*Review, error) {
 	reviews := []*Review{}
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.Desc, &review.CreatedAt)
+		err := rows.Scan(&review.ID, &review.BookID, &review.UserID, &review.Rating, &review.SubRatings.Plot, &review.SubRatings.Characters, &review.SubRatings.Prose, &review.SubRatings.Pacing, &review.Desc, &review.BodyHTML, &review.Spoiler, &review.Hidden, &review.Helpful, &review.Unhelpful, &review.CreatedAt, &review.UpdatedAt, &review.EditCount)
 		if err != nil {
 			return nil, err
 		}
+		review.splitSpoilers()
 		reviews = append(reviews, &review)
 	}
 
@@ -100,19 +281,24 @@ func (r ReviewModel) GetUser(id int64) ([]*Review, error) {
 	return reviews, nil
 }
 
-/* Select all reviews */
-func (r ReviewModel) GetAll(filters Filters) ([]*Review, Metadata, error) {
+/* Select the reviews of a book, optionally only those in a given star (4 takes in 4 and 4.5) or with (or without) any text */
+func (r ReviewModel) GetAll(bookID int64, rating int64, hasText *bool, filters Filters) ([]*Review, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT id, book_id, user_id, rating, description
+		SELECT COUNT(*) OVER(), id, book_id, COALESCE(user_id, 0), rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, hidden, helpful_count, unhelpful_count, created_at, updated_at, edit_count
 		FROM reviews
+		WHERE book_id = $1 AND NOT hidden
+		AND (FLOOR(rating) = $2 OR $2 = 0)
+		AND ($3::bool IS NULL OR $3::bool = (TRIM(description) <> ''))
 		ORDER BY %s %s, id ASC
-		LIMIT $1 OFFSET $2
+		LIMIT $4 OFFSET $5
 	`, filters.sortColumn(), filters.sortDirection())
 
+	args := []any{bookID, rating, hasText, filters.limit(), filters.offset()}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := r.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -123,10 +309,11 @@ func (r ReviewModel) GetAll(filters Filters) ([]*Review, Metadata, error) {
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(&totalRecords, &review.ID, &review.BookID, &review.UserID, &review.Rating, &review.Desc, &review.CreatedAt)
+		err := rows.Scan(&totalRecords, &review.ID, &review.BookID, &review.UserID, &review.Rating, &review.SubRatings.Plot, &review.SubRatings.Characters, &review.SubRatings.Prose, &review.SubRatings.Pacing, &review.Desc, &review.BodyHTML, &review.Spoiler, &review.Hidden, &review.Helpful, &review.Unhelpful, &review.CreatedAt, &review.UpdatedAt, &review.EditCount)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		review.splitSpoilers()
 		reviews = append(reviews, &review)
 	}
 
@@ -140,20 +327,109 @@ func (r ReviewModel) GetAll(filters Filters) ([]*Review, Metadata, error) {
 	return reviews, metadata, nil
 }
 
-/* Update a review */
+/* Update a review's ratings and body, keeping the version it replaces. The book and the reviewer never change */
 func (r ReviewModel) Update(review *Review) error {
+	err := review.render()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	archived, err := insertRevision(ctx, tx, "id = $1", review.ID)
+	if err != nil {
+		return err
+	}
+	if !archived {
+		return ErrRecordNotFound
+	}
+
 	query := `
 		UPDATE reviews
-		SET book_id = $1, user_id = $2, rating = $3, description = $4
-		WHERE id = $5
-		RETURNING id
+		SET rating = $1, plot_rating = $2, characters_rating = $3, prose_rating = $4, pacing_rating = $5,
+			description = $6, body_html = $7, spoiler = $8, updated_at = NOW(), edit_count = edit_count + 1
+		WHERE id = $9
+		RETURNING updated_at, edit_count
+	`
+	sub := review.SubRatings
+	args := []any{review.Rating, sub.Plot, sub.Characters, sub.Prose, sub.Pacing, review.Desc, review.BodyHTML, review.Spoiler, review.ID}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.EditCount)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	review.splitSpoilers()
+	return nil
+}
+
+/* Select the earlier versions of a review, newest first */
+func (r ReviewModel) GetRevisions(reviewID int64) ([]*ReviewRevision, error) {
+	query := `
+		SELECT id, review_id, rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, written_at, replaced_at
+		FROM review_revisions
+		WHERE review_id = $1
+		ORDER BY replaced_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*ReviewRevision{}
+	for rows.Next() {
+		var revision ReviewRevision
+		sub := &revision.SubRatings
+		err := rows.Scan(&revision.ID, &revision.ReviewID, &revision.Rating, &sub.Plot, &sub.Characters, &sub.Prose, &sub.Pacing, &revision.Desc, &revision.BodyHTML, &revision.Spoiler, &revision.WrittenAt, &revision.ReplacedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+/* Average the ratings given in a book's visible reviews */
+func (r ReviewModel) Summarize(bookID int64) (*RatingSummary, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(ROUND(AVG(rating), 2), 0), ROUND(AVG(plot_rating), 2), ROUND(AVG(characters_rating), 2),
+			ROUND(AVG(prose_rating), 2), ROUND(AVG(pacing_rating), 2)
+		FROM reviews
+		WHERE book_id = $1 AND NOT hidden
 	`
 
-	args := []any{review.BookID, review.UserID, review.Rating, review.Desc, review.ID}
+	var summary RatingSummary
+	sub := &summary.SubRatings
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID)
+	err := r.DB.QueryRowContext(ctx, query, bookID).Scan(&summary.Reviews, &summary.Average, &sub.Plot, &sub.Characters, &sub.Prose, &sub.Pacing)
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
 }
 
 /* Delete a review */
@@ -186,11 +462,134 @@ func (r ReviewModel) Delete(id int64) error {
 	return nil
 }
 
-/* Validation for review */
-func ValidateReview(v *validator.Validator, review *Review) {
+/* Record a user's helpful or unhelpful vote on a review, replacing any earlier vote, and refresh its counts */
+func (r ReviewModel) Vote(reviewID int64, userID int64, helpful bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO review_votes (review_id, user_id, helpful)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id, user_id) DO UPDATE SET helpful = EXCLUDED.helpful
+	`
+	_, err = tx.ExecContext(ctx, query, reviewID, userID, helpful)
+	if err != nil {
+		return err
+	}
+
+	err = refreshVoteCounts(ctx, tx, reviewID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/* Take back a user's vote on a review and refresh its counts */
+func (r ReviewModel) Unvote(reviewID int64, userID int64) error {
+	if reviewID < 1 || userID < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM review_votes
+		WHERE review_id = $1 AND user_id = $2
+	`
+	result, err := tx.ExecContext(ctx, query, reviewID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = refreshVoteCounts(ctx, tx, reviewID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/* Copy the current version of a review into its history before it is overwritten, reporting whether there was one. The row stays locked until the transaction ends */
+func insertRevision(ctx context.Context, tx *sql.Tx, where string, args ...any) (bool, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO review_revisions (review_id, rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, written_at)
+		SELECT id, rating, plot_rating, characters_rating, prose_rating, pacing_rating, description, body_html, spoiler, COALESCE(updated_at, created_at)
+		FROM reviews
+		WHERE %s
+		FOR UPDATE
+	`, where)
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+/* Recount the votes on a review, so the stored counts can't drift from the votes themselves */
+func refreshVoteCounts(ctx context.Context, tx *sql.Tx, reviewID int64) error {
+	query := `
+		UPDATE reviews
+		SET helpful_count = (SELECT COUNT(*) FROM review_votes WHERE review_id = $1 AND helpful),
+			unhelpful_count = (SELECT COUNT(*) FROM review_votes WHERE review_id = $1 AND NOT helpful)
+		WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, reviewID)
+	return err
+}
+
+/* Validation for review, maxLength is the longest body accepted in bytes */
+func ValidateReview(v *validator.Validator, screener *screening.Screener, maxLength int, review *Review) {
 	v.Check(review.BookID > 0, "review", "must be a positive integer")
 	v.Check(review.UserID > 0, "review", "must be a positive integer")
 	v.Check(review.Desc != "", "review", "must be provided")
-	v.Check(len(review.Desc) <= 225, "review", "must not be more than 225 bytes long")
-	v.Check(review.Rating >= 1 && review.Rating <= 5, "review", "must be between 1 and 5")
+	v.Check(len(review.Desc) <= maxLength, "review", fmt.Sprintf("must not be more than %d bytes long", maxLength))
+	v.Check(validHalfStar(review.Rating), "review", "must be between 1 and 5 in steps of 0.5")
+
+	for name, rating := range map[string]*float64{
+		"plot":       review.SubRatings.Plot,
+		"characters": review.SubRatings.Characters,
+		"prose":      review.SubRatings.Prose,
+		"pacing":     review.SubRatings.Pacing,
+	} {
+		v.Check(rating == nil || validHalfStar(*rating), "sub_ratings."+name, "must be between 1 and 5 in steps of 0.5")
+	}
+
+	_, ok := ParseSpoilers(review.Desc)
+	v.Check(ok, "review", "every [spoiler] must be closed by a [/spoiler] and they can't be nested")
+
+	screenText(v, screener, poster(review.ID, review.UserID), screening.Field{Name: "review", Text: review.Desc})
+}
+
+/* Ratings go from 1 to 5 in half stars */
+func validHalfStar(rating float64) bool {
+	return rating >= 1 && rating <= 5 && rating*2 == math.Trunc(rating*2)
 }
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/thats-insane/awt-final/internal/screening"
+	"github.com/thats-insane/awt-final/internal/validator"
+)
+
+/* Run user text through the screener, flagged text is kept in the validator's flags under its report reason. A nil screener means no screening rules are configured */
+func screenText(v *validator.Validator, screener *screening.Screener, userID int64, fields ...screening.Field) {
+	if screener == nil {
+		return
+	}
+
+	for _, finding := range screener.Screen(userID, fields...) {
+		switch finding.Action {
+		case screening.Reject:
+			v.AddError(finding.Field, finding.Message)
+		case screening.Flag:
+			v.Flag(finding.Reason, fmt.Sprintf("%s %s", finding.Field, finding.Message))
+		}
+	}
+}
+
+/* Only new content counts as posting, edits are screened without their author so posting limits don't apply to them */
+func poster(contentID int64, userID int64) int64 {
+	if contentID > 0 {
+		return 0
+	}
+	return userID
+}
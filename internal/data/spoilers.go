@@ -0,0 +1,109 @@
+package data
+
+import (
+	"strings"
+
+	"github.com/thats-insane/awt-final/internal/markdown"
+)
+
+const (
+	spoilerOpen   = markdown.SpoilerOpen
+	spoilerClose  = markdown.SpoilerClose
+	spoilerHidden = "[spoiler hidden]"
+)
+
+/* A piece of review text, spoiler segments are meant to be blurred by clients */
+type Segment struct {
+	Text    string `json:"text"`
+	Spoiler bool   `json:"spoiler"`
+}
+
+/* Break text into plain and spoiler segments, reporting false when the spoiler markup is unbalanced or nested */
+func ParseSpoilers(text string) ([]Segment, bool) {
+	segments := []Segment{}
+	rest := text
+	for rest != "" {
+		open := strings.Index(rest, spoilerOpen)
+		closing := strings.Index(rest, spoilerClose)
+		if open == -1 {
+			if closing != -1 {
+				return nil, false
+			}
+			segments = append(segments, Segment{Text: rest})
+			break
+		}
+		if closing != -1 && closing < open {
+			return nil, false
+		}
+
+		if open > 0 {
+			segments = append(segments, Segment{Text: rest[:open]})
+		}
+		rest = rest[open+len(spoilerOpen):]
+
+		end := strings.Index(rest, spoilerClose)
+		if end == -1 || strings.Contains(rest[:end], spoilerOpen) {
+			return nil, false
+		}
+		if end > 0 {
+			segments = append(segments, Segment{Text: rest[:end], Spoiler: true})
+		}
+		rest = rest[end+len(spoilerClose):]
+	}
+	return segments, true
+}
+
+/* Fill in a review's segments, a review marked as a spoiler is one spoiler segment with the markup removed */
+func (review *Review) splitSpoilers() {
+	segments, ok := ParseSpoilers(review.Desc)
+	if !ok {
+		// reviews saved before the markup was checked are shown as they were written
+		segments = []Segment{{Text: review.Desc}}
+	}
+
+	if review.Spoiler {
+		var text strings.Builder
+		for _, segment := range segments {
+			text.WriteString(segment.Text)
+		}
+		segments = []Segment{{Text: text.String(), Spoiler: true}}
+	}
+	review.Segments = segments
+}
+
+/* Redact the spoilers in a review, leaving a placeholder wherever one was */
+func (review *Review) HideSpoilers() {
+	var text strings.Builder
+	for i, segment := range review.Segments {
+		if segment.Spoiler {
+			review.Segments[i].Text = ""
+			text.WriteString(spoilerHidden)
+			continue
+		}
+		text.WriteString(segment.Text)
+	}
+	review.Desc = text.String()
+
+	// the cached HTML still has the spoilers in it, so render the redacted text instead
+	review.BodyHTML, _ = markdown.Render(review.Desc)
+}
+
+/* Render a review's Markdown to sanitized HTML, ready to be cached alongside it. Spoilers are parsed along with the rest of the Markdown */
+func (review *Review) render() error {
+	html, err := markdown.Render(review.Desc)
+	if err != nil {
+		return err
+	}
+	review.BodyHTML = html
+	return nil
+}
+
+/* Redact the spoilers in an earlier version of a review, the same way as in the review itself */
+func (revision *ReviewRevision) HideSpoilers() {
+	review := Review{Desc: revision.Desc, Spoiler: revision.Spoiler}
+	review.splitSpoilers()
+	review.HideSpoilers()
+
+	revision.Desc = review.Desc
+	revision.BodyHTML = review.BodyHTML
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSpoilers(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Segment
+		ok   bool
+	}{
+		{"empty", "", []Segment{}, true},
+		{"no spoilers", "a good book", []Segment{{Text: "a good book"}}, true},
+		{"inline", "the [spoiler]butler[/spoiler] did it", []Segment{{Text: "the "}, {Text: "butler", Spoiler: true}, {Text: " did it"}}, true},
+		{"whole text", "[spoiler]all of it[/spoiler]", []Segment{{Text: "all of it", Spoiler: true}}, true},
+		{"multi-paragraph", "[spoiler]first\n\nsecond[/spoiler]", []Segment{{Text: "first\n\nsecond", Spoiler: true}}, true},
+		{"empty spoiler", "a[spoiler][/spoiler]b", []Segment{{Text: "a"}, {Text: "b"}}, true},
+		{"unclosed", "[spoiler]never closed", nil, false},
+		{"stray close", "closed[/spoiler] early", nil, false},
+		{"close before open", "[/spoiler]a[spoiler]", nil, false},
+		{"nested", "[spoiler]a [spoiler]b[/spoiler][/spoiler]", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseSpoilers(tt.text)
+			if ok != tt.ok {
+				t.Fatalf("got ok %t, want %t", ok, tt.ok)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderReviewSpoilers(t *testing.T) {
+	review := &Review{Desc: "so [spoiler]first\n\nsecond[/spoiler] then"}
+	err := review.render()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review.splitSpoilers()
+	review.HideSpoilers()
+	if review.Desc != "so [spoiler hidden] then" {
+		t.Errorf("got desc %q", review.Desc)
+	}
+	if review.BodyHTML != "<p>so [spoiler hidden] then</p>\n" {
+		t.Errorf("got html %q", review.BodyHTML)
+	}
+}
+
+func TestRevisionHideSpoilers(t *testing.T) {
+	tests := []struct {
+		name     string
+		revision ReviewRevision
+		want     string
+	}{
+		{"inline", ReviewRevision{Desc: "the [spoiler]butler[/spoiler] did it"}, "the [spoiler hidden] did it"},
+		{"marked as a spoiler", ReviewRevision{Desc: "everyone dies", Spoiler: true}, "[spoiler hidden]"},
+		{"no spoilers", ReviewRevision{Desc: "a good book"}, "a good book"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revision := tt.revision
+			revision.BodyHTML = "<p>cached</p>"
+			revision.HideSpoilers()
+			if revision.Desc != tt.want {
+				t.Errorf("got desc %q, want %q", revision.Desc, tt.want)
+			}
+			if revision.BodyHTML != "<p>"+tt.want+"</p>\n" {
+				t.Errorf("got html %q", revision.BodyHTML)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"github.com/thats-insane/awt-final/internal/validator"
@@ -14,6 +15,11 @@ import (
 const ScopeActivation = "activation"
 const ScopeAuthentication = "authentication"
 const ScopeReset = "password-reset"
+const ScopeExport = "export"
+const ScopeEmailChange = "email-change"
+const ScopeUnlock = "unlock"
+const ScopeMFAPending = "mfa-pending"
+const ScopeRefresh = "refresh"
 
 type Token struct {
 	Plaintext string
@@ -21,6 +27,20 @@ type Token struct {
 	UserID    int64
 	Expiry    time.Time
 	Scope     string
+	UserAgent string `json:"-"`
+	IP        string `json:"-"`
+	FamilyID  int64  `json:"-"`
+}
+
+/* A login as the user sees it in their list of sessions, made up of the access and refresh tokens in one family */
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"`
 }
 
 type TokenModel struct {
@@ -67,19 +87,171 @@ func (t TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+/* Start a new session, a short-lived access token and a refresh token in a new family, remembering the client they were issued to */
+func (t TokenModel) NewSession(userID int64, accessTTL time.Duration, refreshTTL time.Duration, userAgent string, ip string) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var familyID int64
+	err = tx.QueryRowContext(ctx, `SELECT nextval('token_families_seq')`).Scan(&familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertTokenPair(ctx, tx, userID, familyID, accessTTL, time.Now().Add(refreshTTL), userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
+
+/* Swap a refresh token for a new access and refresh token in the same family. A refresh token can only be used once, and using one again means it was stolen, so the whole family is revoked. The new refresh token keeps the old one's expiry, so a session can't be kept alive forever */
+func (t TokenModel) Rotate(plaintext string, accessTTL time.Duration, userAgent string, ip string) (*Token, *Token, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT user_id, family_id, used_at, expiry
+		FROM tokens
+		WHERE hash = $1 AND scope = $2 AND expiry > $3
+		FOR UPDATE
+	`
+
+	var userID, familyID int64
+	var usedAt *time.Time
+	var expiry time.Time
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeRefresh, time.Now()).Scan(&userID, &familyID, &usedAt, &expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if usedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1`, familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW() WHERE hash = $1`, hash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the family's older access tokens stop working once a new one is issued
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1 AND scope = $2`, familyID, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertTokenPair(ctx, tx, userID, familyID, accessTTL, expiry, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
+
+/* Generate and insert an access and refresh token for one family, neither of which outlives the session's expiry */
+func insertTokenPair(ctx context.Context, tx *sql.Tx, userID int64, familyID int64, accessTTL time.Duration, sessionExpiry time.Time, userAgent string, ip string) (*Token, *Token, error) {
+	access, err := generateToken(userID, accessTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+	if access.Expiry.After(sessionExpiry) {
+		access.Expiry = sessionExpiry
+	}
+	refresh, err := generateToken(userID, time.Until(sessionExpiry), ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh.Expiry = sessionExpiry
+
+	for _, token := range []*Token{access, refresh} {
+		token.UserAgent = userAgent
+		token.IP = ip
+		token.FamilyID = familyID
+
+		err = insertToken(ctx, tx, token)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return access, refresh, nil
+}
+
 /* Insert a token into the database */
 func (t TokenModel) Insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertToken(ctx, tx, token)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertToken(ctx context.Context, tx *sql.Tx, token *Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope) 
-        VALUES ($1, $2, $3, $4)
+		INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip, family_id) 
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))
 	`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP, token.FamilyID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+/* Delete every token that has expired. Used refresh tokens are kept until then so reusing one is still caught, and they expire with the rest of their session */
+func (t TokenModel) DeleteExpired() error {
+	query := `
+		DELETE FROM tokens
+		WHERE expiry < NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := t.DB.ExecContext(ctx, query, args...)
+	_, err := t.DB.ExecContext(ctx, query)
 	return err
 }
 
@@ -96,3 +268,117 @@ func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := t.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+/* Delete the token with this plaintext along with the rest of its family, used to log out of the current session */
+func (t TokenModel) DeleteSessionForPlaintext(plaintext string) error {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1 OR family_id = (SELECT family_id FROM tokens WHERE hash = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, hash[:])
+	return err
+}
+
+/* Delete every access and refresh token a user has, logging them out everywhere */
+func (t TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh)
+	return err
+}
+
+/* Record that a session was just used. Only written once a minute so busy clients don't update the row on every request */
+func (t TokenModel) Touch(plaintext string) error {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		UPDATE tokens
+		SET last_used_at = NOW()
+		WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, hash[:])
+	return err
+}
+
+/* Select a user's live sessions, one per token family, most recently used first, marking the one making the request. The client details are the ones from the latest rotation */
+func (t TokenModel) GetSessions(userID int64, currentPlaintext string) ([]*Session, error) {
+	hash := sha256.Sum256([]byte(currentPlaintext))
+	query := `
+		SELECT family_id, MIN(created_at), MAX(last_used_at), MAX(expiry),
+			(ARRAY_AGG(user_agent ORDER BY created_at DESC, id DESC))[1], (ARRAY_AGG(ip ORDER BY created_at DESC, id DESC))[1], BOOL_OR(hash = $4)
+		FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3) AND family_id IS NOT NULL
+		GROUP BY family_id
+		HAVING BOOL_OR(used_at IS NULL AND expiry > NOW())
+		ORDER BY COALESCE(MAX(last_used_at), MIN(created_at)) DESC, family_id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.Expiry, &session.UserAgent, &session.IP, &session.Current)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+/* Revoke one of a user's sessions, every token in its family */
+func (t TokenModel) DeleteSession(userID int64, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM tokens
+		WHERE family_id = $1 AND user_id = $2 AND scope IN ($3, $4)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.DB.ExecContext(ctx, query, id, userID, ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -5,22 +5,52 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"net/url"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-final/internal/screening"
 	"github.com/thats-insane/awt-final/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var AnonUser = &User{}
 
+/* What happens to a user's reviews and lists when they delete their account */
+const (
+	DeletionAnonymize = "anonymize"
+	DeletionRemove    = "delete"
+)
+
 type User struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Username   string    `json:"username"`
+	Email      string    `json:"email"`
+	Password   password  `json:"-"`
+	Activated  bool      `json:"activated"`
+	Version    int       `json:"-"`
+	Hidden     bool      `json:"-"`
+	MFAEnabled bool      `json:"-"`
+	Profile
+}
+
+/* The parts of a user that they fill in about themselves */
+type Profile struct {
+	DisplayName     string   `json:"display_name"`
+	Bio             string   `json:"bio"`
+	AvatarURL       string   `json:"avatar_url"`
+	Location        string   `json:"location"`
+	FavouriteGenres []string `json:"favourite_genres"`
+	Website         string   `json:"website"`
+}
+
+/* What everyone else gets to see of a user, leaving out their email address */
+type PublicUser struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	Profile
 }
 
 type password struct {
@@ -32,13 +62,23 @@ type UserModel struct {
 	DB *sql.DB
 }
 
+/* The public profile of a user */
+func (u *User) Public() *PublicUser {
+	return &PublicUser{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt,
+		Username:  u.Username,
+		Profile:   u.Profile,
+	}
+}
+
 /* Check if current user is anon */
 func (u *User) IsAnon() bool {
 	return u == AnonUser
 }
 
-/* Insert a user into the database */
-func (u UserModel) Insert(user *User) error {
+/* Insert a user into the database along with the permissions they start with, so there is never an account without them */
+func (u UserModel) Insert(user *User, permissions ...string) error {
 	query := `
 	INSERT INTO users (username, email, password, activated)
 	VALUES ($1, $2, $3, $4)
@@ -49,7 +89,13 @@ func (u UserModel) Insert(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -58,13 +104,20 @@ func (u UserModel) Insert(user *User) error {
 			return err
 		}
 	}
-	return nil
+
+	_, err = tx.ExecContext(ctx, addPermissionsQuery, user.ID, pq.Array(permissions))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 /* Select a user based on their ID */
 func (u UserModel) Get(id int64) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, password, activated, version
+		SELECT id, created_at, username, email, password, activated, version, hidden, totp_enabled,
+			display_name, bio, avatar_url, location, favourite_genres, website
 		FROM users
 		WHERE id = $1
 	`
@@ -73,7 +126,8 @@ func (u UserModel) Get(id int64) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version, &user.Hidden, &user.MFAEnabled,
+		&user.DisplayName, &user.Bio, &user.AvatarURL, &user.Location, pq.Array(&user.FavouriteGenres), &user.Website)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -89,12 +143,14 @@ func (u UserModel) Get(id int64) (*User, error) {
 func (u UserModel) Update(user *User) error {
 	query := `
 		UPDATE users 
-        SET username = $1, email = $2, password = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET username = $1, email = $2, password = $3, activated = $4, display_name = $5, bio = $6, avatar_url = $7,
+            location = $8, favourite_genres = $9, website = $10, version = version + 1
+        WHERE id = $11 AND version = $12
         RETURNING version
 	`
 
-	args := []any{user.Username, user.Email, user.Password.hash, user.Activated, user.ID, user.Version}
+	args := []any{user.Username, user.Email, user.Password.hash, user.Activated, user.DisplayName, user.Bio, user.AvatarURL,
+		user.Location, pq.Array(user.FavouriteGenres), user.Website, user.ID, user.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -112,6 +168,132 @@ func (u UserModel) Update(user *User) error {
 	return nil
 }
 
+/* Remember the address a user wants to switch to until they confirm it */
+func (u UserModel) SetPendingEmail(id int64, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := u.DB.ExecContext(ctx, query, email, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+/* Swap a user's email for their pending one, someone may have taken the address since it was requested */
+func (u UserModel) ConfirmPendingEmail(user *User) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, version = version + 1
+		WHERE id = $1 AND pending_email IS NOT NULL
+		RETURNING email, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, user.ID).Scan(&user.Email, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+/* Delete a user and everything personal to them, with the anonymize policy their reviews and lists are kept but no longer attached to anyone */
+func (u UserModel) Delete(id int64, policy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// their votes go with them, so the counts on the reviews they voted on have to be redone
+	rows, err := tx.QueryContext(ctx, `DELETE FROM review_votes WHERE user_id = $1 RETURNING review_id`, id)
+	if err != nil {
+		return err
+	}
+	voted := []int64{}
+	for rows.Next() {
+		var reviewID int64
+		err := rows.Scan(&reviewID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		voted = append(voted, reviewID)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, reviewID := range voted {
+		err = refreshVoteCounts(ctx, tx, reviewID)
+		if err != nil {
+			return err
+		}
+	}
+
+	queries := []string{`DELETE FROM lists WHERE user_id = $1`}
+	if policy == DeletionAnonymize {
+		queries = []string{
+			`UPDATE reviews SET user_id = NULL WHERE user_id = $1`,
+			`UPDATE lists SET user_id = NULL WHERE user_id = $1`,
+		}
+	}
+	// the older reviews archived when duplicates were merged go whatever the policy, they were already replaced
+	queries = append(queries, `DELETE FROM reviews_duplicates WHERE user_id = $1`, `DELETE FROM tokens WHERE user_id = $1`, `DELETE FROM login_failures WHERE scope = 'account' AND key = $1::text`)
+
+	for _, query := range queries {
+		_, err = tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// reviews that weren't anonymized, comments, goals and the rest are removed along with the user
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
 /* Hashes the password */
 func (p *password) Set(plaintext string) error {
 	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), 12)
@@ -166,11 +348,39 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
+/* Validation for the profile a user fills in */
+func ValidateProfile(v *validator.Validator, screener *screening.Screener, profile *Profile) {
+	v.Check(len(profile.DisplayName) <= 100, "display_name", "must not be more than 100 bytes long")
+	v.Check(len(profile.Bio) <= 1000, "bio", "must not be more than 1000 bytes long")
+	v.Check(len(profile.Location) <= 100, "location", "must not be more than 100 bytes long")
+	v.Check(profile.AvatarURL == "" || validWebURL(profile.AvatarURL), "avatar_url", "must be an http or https URL")
+	v.Check(profile.Website == "" || validWebURL(profile.Website), "website", "must be an http or https URL")
+	v.Check(len(profile.FavouriteGenres) <= 10, "favourite_genres", "must not contain more than 10 genres")
+	v.Check(validator.Unique(profile.FavouriteGenres), "favourite_genres", "must not contain duplicate genres")
+	for _, genre := range profile.FavouriteGenres {
+		v.Check(genre != "" && len(genre) <= 50, "favourite_genres", "each genre must be between 1 and 50 bytes long")
+	}
+
+	// editing a profile isn't posting, so no user is passed and posting limits don't apply
+	screenText(v, screener, 0,
+		screening.Field{Name: "display_name", Text: profile.DisplayName},
+		screening.Field{Name: "bio", Text: profile.Bio},
+		screening.Field{Name: "location", Text: profile.Location},
+	)
+}
+
+/* Links in a profile have to point at a website, at most 255 bytes long */
+func validWebURL(value string) bool {
+	u, err := url.ParseRequestURI(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && len(value) <= 255
+}
+
 /* Select a user (for token) */
 func (u UserModel) GetForToken(scope string, plaintext string) (*User, error) {
 	hash := sha256.Sum256([]byte(plaintext))
 	query := `
-		SELECT users.id, users.created_at, users.username, users.email, users.password, users.activated, users.version
+		SELECT users.id, users.created_at, users.username, users.email, users.password, users.activated, users.version, users.hidden, users.totp_enabled,
+			users.display_name, users.bio, users.avatar_url, users.location, users.favourite_genres, users.website
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -185,7 +395,8 @@ func (u UserModel) GetForToken(scope string, plaintext string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version, &user.Hidden, &user.MFAEnabled,
+		&user.DisplayName, &user.Bio, &user.AvatarURL, &user.Location, pq.Array(&user.FavouriteGenres), &user.Website)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -199,7 +410,8 @@ func (u UserModel) GetForToken(scope string, plaintext string) (*User, error) {
 
 func (u UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, password, activated, version
+		SELECT id, created_at, username, email, password, activated, version, hidden, totp_enabled,
+			display_name, bio, avatar_url, location, favourite_genres, website
 		FROM users
 		WHERE email = $1
    `
@@ -208,7 +420,8 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version, &user.Hidden, &user.MFAEnabled,
+		&user.DisplayName, &user.Bio, &user.AvatarURL, &user.Location, pq.Array(&user.FavouriteGenres), &user.Website)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -0,0 +1,186 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SourceGoodreads  = "goodreads"
+	SourceStoryGraph = "storygraph"
+)
+
+var ErrUnknownFormat = errors.New("the file is not a Goodreads or StoryGraph library export")
+
+/* One book from a library export */
+type Entry struct {
+	Title    string
+	Author   string
+	ISBN     string
+	PubYear  int
+	Rating   float64
+	Review   string
+	Shelves  []string
+	DateRead time.Time
+}
+
+/* Read a library export, working out which service it came from using its header row */
+func Parse(r io.Reader) (string, []Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", nil, ErrUnknownFormat
+		}
+		return "", nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	var source string
+	var parse func(row func(string) string) Entry
+	switch {
+	case hasColumns(columns, "Title", "Author", "Exclusive Shelf"):
+		source, parse = SourceGoodreads, parseGoodreads
+	case hasColumns(columns, "Title", "Authors", "ISBN/UID", "Read Status"):
+		source, parse = SourceStoryGraph, parseStoryGraph
+	default:
+		return "", nil, ErrUnknownFormat
+	}
+
+	entries := []Entry{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		row := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		entry := parse(row)
+		if entry.Title == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return source, entries, nil
+}
+
+/* Goodreads keeps one exclusive shelf (read, currently-reading, to-read) plus any custom shelves */
+func parseGoodreads(row func(string) string) Entry {
+	entry := Entry{
+		Title:    row("Title"),
+		Author:   row("Author"),
+		ISBN:     cleanISBN(row("ISBN13")),
+		Rating:   parseRating(row("My Rating")),
+		Review:   strings.ReplaceAll(row("My Review"), "<br/>", "\n"),
+		DateRead: parseDate(row("Date Read")),
+	}
+	if entry.ISBN == "" {
+		entry.ISBN = cleanISBN(row("ISBN"))
+	}
+
+	entry.PubYear, _ = strconv.Atoi(row("Original Publication Year"))
+	if entry.PubYear == 0 {
+		entry.PubYear, _ = strconv.Atoi(row("Year Published"))
+	}
+
+	entry.Shelves = splitShelves(row("Exclusive Shelf") + "," + row("Bookshelves"))
+	return entry
+}
+
+/* StoryGraph has a single read status and free-form tags, which we treat as shelves */
+func parseStoryGraph(row func(string) string) Entry {
+	author, _, _ := strings.Cut(row("Authors"), ",")
+
+	entry := Entry{
+		Title:    row("Title"),
+		Author:   strings.TrimSpace(author),
+		ISBN:     cleanISBN(row("ISBN/UID")),
+		Rating:   parseRating(row("Star Rating")),
+		Review:   row("Review"),
+		DateRead: parseDate(row("Last Date Read")),
+	}
+
+	entry.Shelves = splitShelves(row("Read Status") + "," + row("Tags"))
+	return entry
+}
+
+func hasColumns(columns map[string]int, names ...string) bool {
+	for _, name := range names {
+		if _, ok := columns[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+/* Goodreads wraps ISBNs as ="0143127748" so spreadsheets keep leading zeros */
+func cleanISBN(value string) string {
+	value = strings.Trim(value, `="`)
+	value = strings.ReplaceAll(value, "-", "")
+
+	if len(value) != 10 && len(value) != 13 {
+		return ""
+	}
+	for i, c := range value {
+		if (c < '0' || c > '9') && !(c == 'X' && i == len(value)-1) {
+			return ""
+		}
+	}
+	return value
+}
+
+/* Ratings of zero mean the book was never rated, finer grained ratings such as quarter stars are rounded to the nearest half */
+func parseRating(value string) float64 {
+	rating, err := strconv.ParseFloat(value, 64)
+	if err != nil || rating <= 0 {
+		return 0
+	}
+	return math.Max(1, math.Min(5, math.Round(rating*2)/2))
+}
+
+func parseDate(value string) time.Time {
+	for _, layout := range []string{"2006/01/02", "2006-01-02", "2006/01"} {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+func splitShelves(value string) []string {
+	shelves := []string{}
+	seen := make(map[string]bool)
+	for _, shelf := range strings.Split(value, ",") {
+		shelf = strings.ToLower(strings.TrimSpace(shelf))
+		if shelf == "" || seen[shelf] {
+			continue
+		}
+		seen[shelf] = true
+		shelves = append(shelves, shelf)
+	}
+	return shelves
+}
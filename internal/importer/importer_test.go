@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRating(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"-1", 0},
+		{"not a rating", 0},
+		{"1", 1},
+		{"4", 4},
+		{"3.5", 3.5},
+		{"3.25", 3.5},
+		{"3.74", 3.5},
+		{"3.75", 4},
+		{"0.2", 1},
+		{"7", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRating(tt.value); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanISBN(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`="0143127748"`, "0143127748"},
+		{`="9780143127741"`, "9780143127741"},
+		{"978-0-14-312774-1", "9780143127741"},
+		{"080442957X", "080442957X"},
+		{"08044X9571", ""},
+		{`=""`, ""},
+		{"12345", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := cleanISBN(tt.value); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	goodreads := "\ufeffBook Id,Title,Author,ISBN,ISBN13,My Rating,Year Published,Original Publication Year,Date Read,Bookshelves,Exclusive Shelf,My Review\n" +
+		`1,Dune,Frank Herbert,="0441013597",="9780441013593",5,2005,1965,2023/04/01,"sci-fi, Favourites",read,Great<br/>book` + "\n" +
+		`2,No Rating,Someone,="",="",0,2020,,,,to-read,` + "\n" +
+		`3,,Nobody,,,,,,,,read,` + "\n"
+
+	storygraph := "Title,Authors,Contributors,ISBN/UID,Format,Read Status,Date Added,Last Date Read,Dates Read,Read Count,Moods,Pace,Character- or Plot-Driven?,Strong Character Development?,Loveable Characters?,Diverse Characters?,Flawed Characters?,Star Rating,Review,Content Warnings,Content Warning Description,Tags,Owned?\n" +
+		`Piranesi,"Susanna Clarke, Someone Else",,9781635575637,hardcover,read,2023/01/01,2023/02/03,,1,,,,,,,,4.25,Strange and lovely,,,"fantasy, read",Yes` + "\n"
+
+	tests := []struct {
+		name    string
+		csv     string
+		source  string
+		entries []Entry
+		err     error
+	}{
+		{
+			name:   "goodreads",
+			csv:    goodreads,
+			source: SourceGoodreads,
+			entries: []Entry{
+				{
+					Title:    "Dune",
+					Author:   "Frank Herbert",
+					ISBN:     "9780441013593",
+					PubYear:  1965,
+					Rating:   5,
+					Review:   "Great\nbook",
+					Shelves:  []string{"read", "sci-fi", "favourites"},
+					DateRead: time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Title:   "No Rating",
+					Author:  "Someone",
+					PubYear: 2020,
+					Shelves: []string{"to-read"},
+				},
+			},
+		},
+		{
+			name:   "storygraph",
+			csv:    storygraph,
+			source: SourceStoryGraph,
+			entries: []Entry{
+				{
+					Title:    "Piranesi",
+					Author:   "Susanna Clarke",
+					ISBN:     "9781635575637",
+					Rating:   4.5,
+					Review:   "Strange and lovely",
+					Shelves:  []string{"read", "fantasy"},
+					DateRead: time.Date(2023, time.February, 3, 0, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{name: "empty", csv: "", err: ErrUnknownFormat},
+		{name: "unknown columns", csv: "Name,Writer\nDune,Frank Herbert\n", err: ErrUnknownFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, entries, err := Parse(strings.NewReader(tt.csv))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if source != tt.source {
+				t.Errorf("got source %q, want %q", source, tt.source)
+			}
+			if tt.err == nil && !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("got entries %#v, want %#v", entries, tt.entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var renderer = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify, spoilerExtension{}),
+)
+
+/* Only formatting survives: headings, emphasis, lists, quotes, code and links, plus spoilers */
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("h1", "h2", "h3", "h4", "h5", "h6", "p", "br", "hr", "em", "strong", "del", "ul", "ol", "li", "blockquote", "code", "pre")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowStandardURLs()
+	p.RequireNoFollowOnLinks(true)
+	p.AllowAttrs("start").Matching(regexp.MustCompile(`^[0-9]+$`)).OnElements("ol")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("span", "div")
+	return p
+}()
+
+/* Turn Markdown into HTML that is safe to put straight onto a page */
+func Render(src string) (string, error) {
+	var buf bytes.Buffer
+	err := renderBlockSpoilers(src, &buf)
+	if err != nil {
+		return "", err
+	}
+	return Sanitize(buf.String()), nil
+}
+
+/* Strip anything from HTML that the policy doesn't allow */
+func Sanitize(html string) string {
+	return policy.Sanitize(html)
+}
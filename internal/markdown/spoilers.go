@@ -0,0 +1,191 @@
+package markdown
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	gmrenderer "github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+/* The markup that hides part of a review until the reader asks to see it */
+const (
+	SpoilerOpen  = "[spoiler]"
+	SpoilerClose = "[/spoiler]"
+)
+
+var (
+	kindSpoiler       = ast.NewNodeKind("Spoiler")
+	kindSpoilerMarker = ast.NewNodeKind("SpoilerMarker")
+)
+
+/* A spoiler inside a paragraph or heading, its children are the hidden text */
+type spoiler struct {
+	ast.BaseInline
+}
+
+func (n *spoiler) Kind() ast.NodeKind {
+	return kindSpoiler
+}
+
+func (n *spoiler) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+/* An opening or closing marker that hasn't been paired up yet, they only last until the block they are in is closed */
+type spoilerMarker struct {
+	ast.BaseInline
+	segment text.Segment
+	closing bool
+}
+
+func (n *spoilerMarker) Kind() ast.NodeKind {
+	return kindSpoilerMarker
+}
+
+func (n *spoilerMarker) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+/* Picks out spoiler markers, code spans are parsed before this so markers inside them stay as they were written */
+type spoilerParser struct{}
+
+func (s spoilerParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (s spoilerParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	for _, marker := range []string{SpoilerOpen, SpoilerClose} {
+		if bytes.HasPrefix(line, []byte(marker)) {
+			block.Advance(len(marker))
+			return &spoilerMarker{
+				segment: segment.WithStop(segment.Start + len(marker)),
+				closing: marker == SpoilerClose,
+			}
+		}
+	}
+	// anything else starting with [ is left to the link parser
+	return nil
+}
+
+/* Once a block is parsed its markers are paired up, anything left over is put back as plain text */
+func (s spoilerParser) CloseBlock(parent ast.Node, block text.Reader, pc parser.Context) {
+	pairSpoilers(parent)
+}
+
+/* Pair markers that share a parent, so a spoiler can't start inside emphasis and end outside it */
+func pairSpoilers(parent ast.Node) {
+	var open []*spoilerMarker
+	for child := parent.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		marker, ok := child.(*spoilerMarker)
+		switch {
+		case !ok:
+			if child.HasChildren() {
+				pairSpoilers(child)
+			}
+		case !marker.closing:
+			open = append(open, marker)
+		case len(open) > 0:
+			opener := open[len(open)-1]
+			open = open[:len(open)-1]
+
+			hidden := &spoiler{}
+			for inner := opener.NextSibling(); inner != marker; {
+				following := inner.NextSibling()
+				hidden.AppendChild(hidden, inner)
+				inner = following
+			}
+			parent.InsertBefore(parent, opener, hidden)
+			parent.RemoveChild(parent, opener)
+			parent.RemoveChild(parent, marker)
+		default:
+			parent.ReplaceChild(parent, marker, ast.NewTextSegment(marker.segment))
+		}
+		child = next
+	}
+
+	for _, marker := range open {
+		parent.ReplaceChild(parent, marker, ast.NewTextSegment(marker.segment))
+	}
+}
+
+type spoilerRenderer struct{}
+
+func (r spoilerRenderer) RegisterFuncs(reg gmrenderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSpoiler, r.renderSpoiler)
+}
+
+func (r spoilerRenderer) renderSpoiler(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString(`<span class="spoiler">`)
+	} else {
+		w.WriteString(`</span>`)
+	}
+	return ast.WalkContinue, nil
+}
+
+/* Goldmark extension for spoilers that sit inside a single paragraph or heading */
+type spoilerExtension struct{}
+
+func (e spoilerExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		// ahead of the link parser, which would otherwise claim the [
+		util.Prioritized(spoilerParser{}, 150),
+	))
+	m.Renderer().AddOptions(gmrenderer.WithNodeRenderers(
+		util.Prioritized(spoilerRenderer{}, 500),
+	))
+}
+
+/* Spoilers that run over more than one line can hold whole paragraphs or lists, so they are rendered on their own and wrapped in a block */
+func renderBlockSpoilers(src string, buf *bytes.Buffer) error {
+	for src != "" {
+		start, end := findBlockSpoiler(src)
+		if start == -1 {
+			return renderer.Convert([]byte(src), buf)
+		}
+
+		err := renderer.Convert([]byte(src[:start]), buf)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(`<div class="spoiler">`)
+		err = renderer.Convert([]byte(src[start+len(SpoilerOpen):end]), buf)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(`</div>`)
+		src = src[end+len(SpoilerClose):]
+	}
+	return nil
+}
+
+/* Find the first closed spoiler with a line break in it, returning where its markers start or -1 when there isn't one */
+func findBlockSpoiler(src string) (int, int) {
+	offset := 0
+	for {
+		start := strings.Index(src[offset:], SpoilerOpen)
+		if start == -1 {
+			return -1, -1
+		}
+		start += offset
+
+		inner := start + len(SpoilerOpen)
+		end := strings.Index(src[inner:], SpoilerClose)
+		if end == -1 {
+			return -1, -1
+		}
+		end += inner
+
+		if strings.Contains(src[inner:end], "\n") {
+			return start, end
+		}
+		offset = end + len(SpoilerClose)
+	}
+}
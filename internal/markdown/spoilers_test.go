@@ -0,0 +1,42 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderSpoilers(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"inline", "the [spoiler]butler[/spoiler] did it", `<p>the <span class="spoiler">butler</span> did it</p>`},
+		{"emphasis inside", "[spoiler]*everyone* dies[/spoiler]", `<p><span class="spoiler"><em>everyone</em> dies</span></p>`},
+		{"two in a paragraph", "[spoiler]a[/spoiler] and [spoiler]b[/spoiler]", `<p><span class="spoiler">a</span> and <span class="spoiler">b</span></p>`},
+		{"heading", "# [spoiler]twist[/spoiler]", `<h1><span class="spoiler">twist</span></h1>`},
+		{"multi-paragraph", "[spoiler]first\n\nsecond[/spoiler]", `<div class="spoiler"><p>first</p><p>second</p></div>`},
+		{"multi-paragraph mid sentence", "so [spoiler]first\n\nsecond[/spoiler] then", `<p>so</p><div class="spoiler"><p>first</p><p>second</p></div><p>then</p>`},
+		{"list", "[spoiler]\n- one\n- two\n[/spoiler]", `<div class="spoiler"><ul><li>one</li><li>two</li></ul></div>`},
+		{"code span", "`[spoiler]x[/spoiler]`", `<p><code>[spoiler]x[/spoiler]</code></p>`},
+		{"code span inside", "[spoiler]`x`[/spoiler]", `<p><span class="spoiler"><code>x</code></span></p>`},
+		{"unclosed", "[spoiler]never closed", `<p>[spoiler]never closed</p>`},
+		{"stray close", "closed[/spoiler] early", `<p>closed[/spoiler] early</p>`},
+		{"crosses emphasis", "*[spoiler]a* b[/spoiler]", `<p><em>[spoiler]a</em> b[/spoiler]</p>`},
+		{"escaped", `\[spoiler]a[/spoiler]`, `<p>[spoiler]a[/spoiler]</p>`},
+		{"links still work", "[a link](https://example.com)", `<p><a href="https://example.com" rel="nofollow">a link</a></p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = strings.ReplaceAll(got, "\n", "")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
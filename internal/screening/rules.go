@@ -0,0 +1,176 @@
+package screening
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+/* Characters commonly swapped in for letters to get around word lists */
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b",
+	"@", "a", "$", "s", "!", "i", "|", "l", "+", "t",
+)
+
+/* Rejects or flags blocked words, including leet-speak spellings and stretched out letters */
+type wordRule struct {
+	words map[string]int
+}
+
+func newWordRule(list []string) wordRule {
+	// words are keyed by their squeezed spelling, holding the shortest length that still counts as the word
+	words := make(map[string]int)
+	for _, word := range list {
+		for _, w := range splitWords(word) {
+			key := squeeze(w)
+			if n, ok := words[key]; !ok || len(w) < n {
+				words[key] = len(w)
+			}
+		}
+	}
+	return wordRule{words: words}
+}
+
+func (r wordRule) Check(userID int64, fields []Field) []Finding {
+	findings := []Finding{}
+	for _, field := range fields {
+		for _, w := range splitWords(field.Text) {
+			n, ok := r.words[squeeze(w)]
+			if ok && len(w) >= n {
+				findings = append(findings, Finding{Field: field.Name, Message: "must not contain blocked words"})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+/* Split text into lowercase words, undoing leet-speak inside each one */
+func splitWords(text string) []string {
+	words := []string{}
+	for _, token := range strings.Fields(strings.ToLower(text)) {
+		token = strings.TrimFunc(token, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		token = leet.Replace(token)
+		words = append(words, strings.FieldsFunc(token, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})...)
+	}
+	return words
+}
+
+/* Collapse runs of the same letter, so "baaaad" and "bad" look alike */
+func squeeze(word string) string {
+	var b strings.Builder
+	var last rune
+	for i, r := range word {
+		if i > 0 && r == last {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+var linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)`)
+
+/* Limits how many links a piece of text can carry */
+type linkRule struct {
+	max int
+}
+
+func (r linkRule) Check(userID int64, fields []Field) []Finding {
+	findings := []Finding{}
+	for _, field := range fields {
+		if len(linkRX.FindAllStringIndex(field.Text, -1)) > r.max {
+			findings = append(findings, Finding{Field: field.Name, Message: fmt.Sprintf("must not contain more than %d links", r.max)})
+		}
+	}
+	return findings
+}
+
+/* Catches keyboard mashing and shouting such as "!!!!!!!!!!" */
+type repeatRule struct {
+	max int
+}
+
+func (r repeatRule) Check(userID int64, fields []Field) []Finding {
+	findings := []Finding{}
+	for _, field := range fields {
+		run := 0
+		var last rune
+		for i, c := range field.Text {
+			if i > 0 && c == last && !unicode.IsSpace(c) {
+				run++
+			} else {
+				run = 1
+			}
+			last = c
+
+			if run > r.max {
+				findings = append(findings, Finding{Field: field.Name, Message: fmt.Sprintf("must not repeat a character more than %d times in a row", r.max)})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+/* Limits how many times each user can post within a sliding window */
+type velocityRule struct {
+	max    int
+	window time.Duration
+	mu     *sync.Mutex
+	posts  map[int64][]time.Time
+}
+
+func newVelocityRule(max int, window time.Duration) velocityRule {
+	return velocityRule{
+		max:    max,
+		window: window,
+		mu:     &sync.Mutex{},
+		posts:  make(map[int64][]time.Time),
+	}
+}
+
+/* Only looks at posts already recorded, screening something doesn't count as posting it */
+func (r velocityRule) Check(userID int64, fields []Field) []Finding {
+	if userID < 1 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recent := 0
+	for _, posted := range r.posts[userID] {
+		if time.Since(posted) < r.window {
+			recent++
+		}
+	}
+
+	if recent >= r.max {
+		return []Finding{{Field: "posting", Message: fmt.Sprintf("you can only post %d times every %s, try again later", r.max, r.window)}}
+	}
+	return nil
+}
+
+/* Count a post once it has been saved, dropping the ones that have left the window */
+func (r velocityRule) Record(userID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	recent := []time.Time{}
+	for _, posted := range r.posts[userID] {
+		if now.Sub(posted) < r.window {
+			recent = append(recent, posted)
+		}
+	}
+	r.posts[userID] = append(recent, now)
+}
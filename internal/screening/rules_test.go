@@ -0,0 +1,163 @@
+package screening
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWordRule(t *testing.T) {
+	rule := newWordRule([]string{"idiot", "moron"})
+
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"clean", "a lovely book about gardens", 0},
+		{"plain", "what an idiot", 1},
+		{"capitals", "What an IDIOT", 1},
+		{"leet speak", "what an 1d10t", 1},
+		{"stretched letters", "what a mooooron", 1},
+		{"punctuation", "idiot!!!", 1},
+		{"part of a longer word", "idiotic plot twists", 0},
+		{"squeezed too short", "a mron", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.Check(1, []Field{{Name: "review", Text: tt.text}})
+			if len(got) != tt.want {
+				t.Errorf("got %d findings, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkRule(t *testing.T) {
+	rule := linkRule{max: 1}
+
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"no links", "no links here", 0},
+		{"one link", "see https://example.com", 0},
+		{"two links", "see https://example.com and www.example.org", 1},
+		{"capitals", "HTTP://A.COM HTTPS://B.COM", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.Check(1, []Field{{Name: "review", Text: tt.text}})
+			if len(got) != tt.want {
+				t.Errorf("got %d findings, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestRepeatRule(t *testing.T) {
+	rule := repeatRule{max: 3}
+
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"normal text", "good book", 0},
+		{"at the limit", "wow!!!", 0},
+		{"over the limit", "wow!!!!", 1},
+		{"spaces don't count", "a     b", 0},
+		{"multibyte", "ééééé", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rule.Check(1, []Field{{Name: "review", Text: tt.text}})
+			if len(got) != tt.want {
+				t.Errorf("got %d findings, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestVelocityRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  int64
+		records int
+		checks  int
+		want    int
+	}{
+		{"nothing posted", 1, 0, 1, 0},
+		{"under the limit", 1, 1, 1, 0},
+		{"at the limit", 1, 2, 1, 1},
+		{"checking doesn't count as posting", 1, 0, 5, 0},
+		{"no user", 0, 2, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := newVelocityRule(2, time.Minute)
+			for range tt.records {
+				rule.Record(tt.userID)
+			}
+
+			var got []Finding
+			for range tt.checks {
+				got = rule.Check(tt.userID, nil)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d findings, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestVelocityRuleWindow(t *testing.T) {
+	rule := newVelocityRule(1, time.Minute)
+	rule.posts[1] = []time.Time{time.Now().Add(-2 * time.Minute)}
+
+	if got := rule.Check(1, nil); len(got) != 0 {
+		t.Errorf("posts outside the window should not count, got %d findings", len(got))
+	}
+
+	rule.Record(1)
+	if got := len(rule.posts[1]); got != 1 {
+		t.Errorf("recording should drop posts outside the window, got %d posts", got)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(*Config)
+		rules   int
+		wantErr bool
+	}{
+		{"empty", func(c *Config) {}, 0, false},
+		{"allow is skipped", func(c *Config) { c.Links.Action = Allow }, 0, false},
+		{"flag links", func(c *Config) { c.Links.Action = Flag; c.Links.Max = 2 }, 1, false},
+		{"unknown action", func(c *Config) { c.Links.Action = "block" }, 0, true},
+		{"negative link max", func(c *Config) { c.Links.Action = Flag; c.Links.Max = -1 }, 0, true},
+		{"zero repeat max", func(c *Config) { c.Repeats.Action = Reject }, 0, true},
+		{"bad velocity window", func(c *Config) { c.Velocity.Action = Reject; c.Velocity.Max = 1; c.Velocity.Window = "soon" }, 0, true},
+		{"velocity", func(c *Config) { c.Velocity.Action = Reject; c.Velocity.Max = 1; c.Velocity.Window = "10m" }, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			tt.cfg(&cfg)
+
+			rules, err := build(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if len(rules) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(rules), tt.rules)
+			}
+		})
+	}
+}
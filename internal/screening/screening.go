@@ -0,0 +1,205 @@
+package screening
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+/* What happens to text that breaks a rule */
+const (
+	Reject = "reject"
+	Flag   = "flag"
+	Allow  = "allow"
+)
+
+/* A named piece of user text, such as a review's description */
+type Field struct {
+	Name string
+	Text string
+}
+
+/* A broken rule, Reason is the report reason used when it is flagged for moderation */
+type Finding struct {
+	Field   string
+	Message string
+	Action  string
+	Reason  string
+}
+
+/* A check run over everything a user submits in one go */
+type Rule interface {
+	Check(userID int64, fields []Field) []Finding
+}
+
+/* A rule that keeps track of what users have posted, such as how often */
+type recorder interface {
+	Record(userID int64)
+}
+
+type Config struct {
+	Words struct {
+		Action string   `json:"action"`
+		List   []string `json:"list"`
+	} `json:"words"`
+	Links struct {
+		Action string `json:"action"`
+		Max    int    `json:"max"`
+	} `json:"links"`
+	Repeats struct {
+		Action string `json:"action"`
+		Max    int    `json:"max"`
+	} `json:"repeats"`
+	Velocity struct {
+		Action string `json:"action"`
+		Max    int    `json:"max"`
+		Window string `json:"window"`
+	} `json:"velocity"`
+}
+
+type screenedRule struct {
+	rule   Rule
+	action string
+	reason string
+}
+
+/* Runs user text through the configured rules, the rules can be swapped out while it is in use */
+type Screener struct {
+	path  string
+	mu    sync.RWMutex
+	rules []screenedRule
+}
+
+/* Create a screener with the rules in a JSON config file */
+func New(path string) (*Screener, error) {
+	s := &Screener{path: path}
+
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/* Read the config file again, keeping the current rules if it is invalid (posting counts start over) */
+func (s *Screener) Reload() error {
+	file, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var cfg Config
+	err = json.Unmarshal(file, &cfg)
+	if err != nil {
+		return fmt.Errorf("screening config %s: %w", s.path, err)
+	}
+
+	rules, err := build(cfg)
+	if err != nil {
+		return fmt.Errorf("screening config %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+
+	return nil
+}
+
+/* Run a user's submission through every rule that isn't set to allow */
+func (s *Screener) Screen(userID int64, fields ...Field) []Finding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	findings := []Finding{}
+	for _, r := range s.rules {
+		for _, finding := range r.rule.Check(userID, fields) {
+			finding.Action = r.action
+			finding.Reason = r.reason
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+/* Tell the rules a user has posted something, call it once the post has been saved */
+func (s *Screener) Record(userID int64) {
+	if userID < 1 {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.rules {
+		if rec, ok := r.rule.(recorder); ok {
+			rec.Record(userID)
+		}
+	}
+}
+
+func build(cfg Config) ([]screenedRule, error) {
+	rules := []screenedRule{}
+
+	add := func(name string, action string, reason string, rule func() (Rule, error)) error {
+		switch action {
+		case "", Allow:
+			return nil
+		case Reject, Flag:
+		default:
+			return fmt.Errorf("%s: action must be one of reject, flag or allow", name)
+		}
+
+		r, err := rule()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		rules = append(rules, screenedRule{rule: r, action: action, reason: reason})
+		return nil
+	}
+
+	err := add("words", cfg.Words.Action, "abuse", func() (Rule, error) {
+		return newWordRule(cfg.Words.List), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = add("links", cfg.Links.Action, "spam", func() (Rule, error) {
+		if cfg.Links.Max < 0 {
+			return nil, fmt.Errorf("max must not be negative")
+		}
+		return linkRule{max: cfg.Links.Max}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = add("repeats", cfg.Repeats.Action, "spam", func() (Rule, error) {
+		if cfg.Repeats.Max < 1 {
+			return nil, fmt.Errorf("max must be greater than zero")
+		}
+		return repeatRule{max: cfg.Repeats.Max}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = add("velocity", cfg.Velocity.Action, "spam", func() (Rule, error) {
+		window, err := time.ParseDuration(cfg.Velocity.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("window must be a positive duration such as 10m")
+		}
+		if cfg.Velocity.Max < 1 {
+			return nil, fmt.Errorf("max must be greater than zero")
+		}
+		return newVelocityRule(cfg.Velocity.Max, window), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
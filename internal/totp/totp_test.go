@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+/* The SHA-1 secret from RFC 6238 appendix B, "12345678901234567890" base32 encoded */
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC lists eight digit codes, ours are the last six digits of those
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		want     int64
+		ok       bool
+	}{
+		{"current step", "081804", 0, step, true},
+		{"next step", "050471", 0, step + 1, true},
+		{"already used", "081804", step, 0, false},
+		{"wrong code", "000000", 0, 0, false},
+		{"too short", "81804", 0, 0, false},
+		{"too far off", "287082", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, tt.code, now, tt.lastStep)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("got (%d, %t), want (%d, %t)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCodeBadSecret(t *testing.T) {
+	_, err := Code("not base32!", 1)
+	if err == nil {
+		t.Error("expected an error for a secret that isn't base32")
+	}
+}
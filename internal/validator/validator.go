@@ -10,11 +10,13 @@ var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](
 
 type Validator struct {
 	Errors map[string]string
+	Flags  map[string]string
 }
 
 func New() *Validator {
 	return &Validator{
 		Errors: make(map[string]string),
+		Flags:  make(map[string]string),
 	}
 }
 
@@ -30,6 +32,15 @@ func (v *Validator) AddError(key string, msg string) {
 	}
 }
 
+/* Flags don't fail validation, they mark acceptable input that a moderator should look at */
+func (v *Validator) Flag(key string, msg string) {
+	_, exists := v.Flags[key]
+
+	if !exists {
+		v.Flags[key] = msg
+	}
+}
+
 func (v *Validator) Check(acceptable bool, key string, msg string) {
 	if !acceptable {
 		v.AddError(key, msg)
@@ -44,3 +55,12 @@ func PermittedValue(value string, permittedValues ...string) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+/* Check that no value appears more than once */
+func Unique(values []string) bool {
+	uniqueValues := make(map[string]bool)
+	for _, value := range values {
+		uniqueValues[value] = true
+	}
+	return len(values) == len(uniqueValues)
+}
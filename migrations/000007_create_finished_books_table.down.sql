@@ -0,0 +1 @@
+DROP TABLE IF EXISTS finished_books;
\ No newline at end of file
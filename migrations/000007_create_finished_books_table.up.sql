@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS finished_books (
+    id bigserial PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    finished_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, book_id)
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS goals (
+    id bigserial PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    year INT NOT NULL,
+    target INT NOT NULL CHECK (target > 0),
+    genre VARCHAR(50) NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1,
+    UNIQUE (user_id, year, genre)
+);
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS challenges (
+    id bigserial PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(225) NOT NULL,
+    genre VARCHAR(50) NOT NULL DEFAULT '',
+    target INT NOT NULL CHECK (target > 0),
+    starts_at DATE NOT NULL,
+    ends_at DATE NOT NULL CHECK (ends_at >= starts_at),
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS challenge_participants;
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS challenge_participants (
+    challenge_id INT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (challenge_id, user_id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE lists DROP COLUMN IF EXISTS forked_from;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS forked_from INT REFERENCES lists(id) ON DELETE SET NULL;
\ No newline at end of file
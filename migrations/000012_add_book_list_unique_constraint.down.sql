@@ -0,0 +1 @@
+ALTER TABLE book_list DROP CONSTRAINT IF EXISTS book_list_list_id_book_id_key;
\ No newline at end of file
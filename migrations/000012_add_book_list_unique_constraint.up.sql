@@ -0,0 +1,2 @@
+DELETE FROM book_list a USING book_list b WHERE a.list_id = b.list_id AND a.book_id = b.book_id AND a.id > b.id;
+ALTER TABLE book_list ADD CONSTRAINT book_list_list_id_book_id_key UNIQUE (list_id, book_id);
\ No newline at end of file
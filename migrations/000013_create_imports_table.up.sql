@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS imports (
+    id bigserial PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    total INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    books_matched INT NOT NULL DEFAULT 0,
+    books_created INT NOT NULL DEFAULT 0,
+    lists_created INT NOT NULL DEFAULT 0,
+    reviews_imported INT NOT NULL DEFAULT 0,
+    reads_imported INT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) WITH TIME ZONE
+);
\ No newline at end of file
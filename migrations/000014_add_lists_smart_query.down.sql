@@ -0,0 +1,2 @@
+ALTER TABLE lists DROP COLUMN IF EXISTS query;
+ALTER TABLE lists DROP COLUMN IF EXISTS kind;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'manual';
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS query JSONB;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_book_id_user_id_key;
+
+INSERT INTO reviews (id, book_id, user_id, rating, description, created_at)
+SELECT id, book_id, user_id, rating, description, created_at FROM reviews_duplicates
+ON CONFLICT (id) DO NOTHING;
+
+DROP TABLE IF EXISTS reviews_duplicates;
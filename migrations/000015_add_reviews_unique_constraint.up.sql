@@ -0,0 +1,11 @@
+-- Users could review the same book more than once before this constraint. Only the newest review of each
+-- book is kept, the older ones are moved into reviews_duplicates (with the id of the review that replaced
+-- them) instead of being deleted, and the down migration puts them back.
+CREATE TABLE IF NOT EXISTS reviews_duplicates AS
+SELECT reviews.*, kept.id AS kept_review_id
+FROM reviews
+INNER JOIN (SELECT MAX(id) AS id, book_id, user_id FROM reviews GROUP BY book_id, user_id) AS kept
+ON kept.book_id = reviews.book_id AND kept.user_id = reviews.user_id AND kept.id > reviews.id;
+
+DELETE FROM reviews WHERE id IN (SELECT id FROM reviews_duplicates);
+ALTER TABLE reviews ADD CONSTRAINT reviews_book_id_user_id_key UNIQUE (book_id, user_id);
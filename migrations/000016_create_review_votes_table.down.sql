@@ -0,0 +1 @@
+DROP TABLE IF EXISTS review_votes;
\ No newline at end of file
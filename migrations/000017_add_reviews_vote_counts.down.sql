@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reviews_book_id_helpful_count_idx;
+ALTER TABLE reviews DROP COLUMN IF EXISTS unhelpful_count;
+ALTER TABLE reviews DROP COLUMN IF EXISTS helpful_count;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS helpful_count INT NOT NULL DEFAULT 0;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS unhelpful_count INT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS reviews_book_id_helpful_count_idx ON reviews (book_id, helpful_count DESC);
\ No newline at end of file
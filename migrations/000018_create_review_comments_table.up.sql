@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS review_comments (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id INT REFERENCES review_comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS review_comments_review_id_idx ON review_comments (review_id, parent_id);
\ No newline at end of file
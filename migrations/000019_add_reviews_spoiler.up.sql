@@ -0,0 +1 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS spoiler BOOLEAN NOT NULL DEFAULT false;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS reports (
+    id bigserial PRIMARY KEY,
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type TEXT NOT NULL CHECK (target_type IN ('review', 'list', 'comment', 'user')),
+    target_id INT NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'abuse', 'spoiler')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS reports_status_idx ON reports (status, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS reports_open_reporter_target_key ON reports (reporter_id, target_type, target_id) WHERE status = 'open';
\ No newline at end of file
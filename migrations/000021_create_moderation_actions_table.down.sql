@@ -0,0 +1 @@
+DROP TABLE IF EXISTS moderation_actions;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id bigserial PRIMARY KEY,
+    moderator_id INT REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id INT NOT NULL,
+    report_id INT REFERENCES reports(id) ON DELETE SET NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS hidden;
+ALTER TABLE review_comments DROP COLUMN IF EXISTS hidden;
+ALTER TABLE lists DROP COLUMN IF EXISTS hidden;
+ALTER TABLE reviews DROP COLUMN IF EXISTS hidden;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE reports ALTER COLUMN reporter_id DROP NOT NULL;
\ No newline at end of file
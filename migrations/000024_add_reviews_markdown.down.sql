@@ -0,0 +1,2 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS body_html;
+ALTER TABLE reviews ALTER COLUMN description TYPE VARCHAR(225) USING LEFT(description, 225);
@@ -0,0 +1,7 @@
+ALTER TABLE reviews ALTER COLUMN description TYPE TEXT;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS body_html TEXT NOT NULL DEFAULT '';
+
+-- existing reviews are plain text, so escaping them is all the rendering they need
+UPDATE reviews
+SET body_html = '<p>' || REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(description, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '[spoiler]', '<span class="spoiler">'), '[/spoiler]', '</span>') || '</p>'
+WHERE TRIM(description) <> '';
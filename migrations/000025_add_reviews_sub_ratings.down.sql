@@ -0,0 +1,8 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS pacing_rating;
+ALTER TABLE reviews DROP COLUMN IF EXISTS prose_rating;
+ALTER TABLE reviews DROP COLUMN IF EXISTS characters_rating;
+ALTER TABLE reviews DROP COLUMN IF EXISTS plot_rating;
+
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_rating_check;
+ALTER TABLE reviews ALTER COLUMN rating TYPE INT USING CEIL(rating);
+ALTER TABLE reviews ADD CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 5);
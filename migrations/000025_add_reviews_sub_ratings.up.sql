@@ -0,0 +1,8 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_rating_check;
+ALTER TABLE reviews ALTER COLUMN rating TYPE NUMERIC(2, 1);
+ALTER TABLE reviews ADD CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 5 AND rating * 2 = TRUNC(rating * 2));
+
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS plot_rating NUMERIC(2, 1) CHECK (plot_rating BETWEEN 1 AND 5 AND plot_rating * 2 = TRUNC(plot_rating * 2));
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS characters_rating NUMERIC(2, 1) CHECK (characters_rating BETWEEN 1 AND 5 AND characters_rating * 2 = TRUNC(characters_rating * 2));
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS prose_rating NUMERIC(2, 1) CHECK (prose_rating BETWEEN 1 AND 5 AND prose_rating * 2 = TRUNC(prose_rating * 2));
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS pacing_rating NUMERIC(2, 1) CHECK (pacing_rating BETWEEN 1 AND 5 AND pacing_rating * 2 = TRUNC(pacing_rating * 2));
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS review_revisions;
+ALTER TABLE reviews DROP COLUMN IF EXISTS edit_count;
+ALTER TABLE reviews DROP COLUMN IF EXISTS updated_at;
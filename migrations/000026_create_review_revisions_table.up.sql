@@ -0,0 +1,19 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS updated_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS edit_count INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS review_revisions (
+    id bigserial PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    rating NUMERIC(2, 1) NOT NULL,
+    plot_rating NUMERIC(2, 1),
+    characters_rating NUMERIC(2, 1),
+    prose_rating NUMERIC(2, 1),
+    pacing_rating NUMERIC(2, 1),
+    description TEXT NOT NULL,
+    body_html TEXT NOT NULL,
+    spoiler BOOLEAN NOT NULL,
+    written_at timestamp(0) WITH TIME ZONE NOT NULL,
+    replaced_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS review_revisions_review_id_idx ON review_revisions (review_id, replaced_at);
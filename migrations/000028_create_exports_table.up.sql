@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS exports (
+    id bigserial PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    archive BYTEA,
+    error TEXT NOT NULL DEFAULT '',
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS exports_user_id_idx ON exports (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS events (
+    id bigserial PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('review_created', 'book_finished', 'list_created', 'list_book_added')),
+    book_id INT REFERENCES books(id) ON DELETE CASCADE,
+    review_id INT REFERENCES reviews(id) ON DELETE CASCADE,
+    list_id INT REFERENCES lists(id) ON DELETE CASCADE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS events_user_id_idx ON events (user_id, created_at);
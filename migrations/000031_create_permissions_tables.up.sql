@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('books:write'), ('reviews:write'), ('lists:write'), ('reviews:moderate'), ('users:admin');
+
+-- existing accounts keep what any user could do before, catalog writes, moderation and admin have to be granted
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users CROSS JOIN permissions
+WHERE permissions.code IN ('reviews:write', 'lists:write');
+
+-- the first admin has to be granted by hand, e.g.
+-- INSERT INTO users_permissions SELECT <user id>, id FROM permissions;
@@ -0,0 +1,9 @@
+-- failed logins are counted per account (key is the user ID) and per client IP
+CREATE TABLE IF NOT EXISTS login_failures (
+    scope TEXT NOT NULL CHECK (scope IN ('account', 'ip')),
+    key TEXT NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) WITH TIME ZONE,
+    PRIMARY KEY (scope, key)
+);
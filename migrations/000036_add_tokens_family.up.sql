@@ -0,0 +1,10 @@
+-- every login starts a family: the access and refresh tokens it is issued, and every pair rotated from them
+CREATE SEQUENCE IF NOT EXISTS token_families_seq;
+
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family_id BIGINT;
+-- refresh tokens are marked used rather than deleted when rotated, so presenting one again can be caught
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) WITH TIME ZONE;
+
+UPDATE tokens SET family_id = nextval('token_families_seq') WHERE scope = 'authentication';
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
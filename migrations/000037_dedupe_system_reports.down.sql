@@ -0,0 +1 @@
+DROP INDEX IF EXISTS reports_open_system_target_key;
@@ -0,0 +1,11 @@
+-- reports raised by text screening have no reporter, so the open report index never matched them and every edit of
+-- flagged content added another one. Keep the oldest open report for each target and reason, dismissing the rest
+UPDATE reports
+SET status = 'dismissed', resolved_at = NOW()
+WHERE reporter_id IS NULL AND status = 'open' AND id NOT IN (
+    SELECT MIN(id) FROM reports
+    WHERE reporter_id IS NULL AND status = 'open'
+    GROUP BY target_type, target_id, reason
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reports_open_system_target_key ON reports (target_type, target_id, reason) WHERE status = 'open' AND reporter_id IS NULL;
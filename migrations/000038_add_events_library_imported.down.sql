@@ -0,0 +1,5 @@
+DELETE FROM events WHERE kind = 'library_imported';
+ALTER TABLE events DROP COLUMN IF EXISTS count;
+
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_kind_check;
+ALTER TABLE events ADD CONSTRAINT events_kind_check CHECK (kind IN ('review_created', 'book_finished', 'list_created', 'list_book_added'));
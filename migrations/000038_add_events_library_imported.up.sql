@@ -0,0 +1,5 @@
+ALTER TABLE events DROP CONSTRAINT IF EXISTS events_kind_check;
+ALTER TABLE events ADD CONSTRAINT events_kind_check CHECK (kind IN ('review_created', 'book_finished', 'list_created', 'list_book_added', 'library_imported'));
+
+-- how many books a library_imported event stands for
+ALTER TABLE events ADD COLUMN IF NOT EXISTS count INT;
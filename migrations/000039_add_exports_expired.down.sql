@@ -0,0 +1,4 @@
+UPDATE exports SET status = 'failed', error = 'the export has expired' WHERE status = 'expired';
+
+ALTER TABLE exports DROP CONSTRAINT IF EXISTS exports_status_check;
+ALTER TABLE exports ADD CONSTRAINT exports_status_check CHECK (status IN ('pending', 'running', 'completed', 'failed'));
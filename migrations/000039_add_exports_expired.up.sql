@@ -0,0 +1,2 @@
+ALTER TABLE exports DROP CONSTRAINT IF EXISTS exports_status_check;
+ALTER TABLE exports ADD CONSTRAINT exports_status_check CHECK (status IN ('pending', 'running', 'completed', 'failed', 'expired'));